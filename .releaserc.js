@@ -1,8 +1,14 @@
+// commits are prefixed with the id of their request, e.g. "[user-001] feat: ..."
+const parserOpts = {
+    headerPattern: /^(?:\[[\w-]+\] )?(\w*)(?:\((.*)\))?: (.*)$/,
+    headerCorrespondence: ["type", "scope", "subject"],
+};
+
 module.exports = {
     branches: ["master"],
     plugins: [
-        "@semantic-release/commit-analyzer",
-        "@semantic-release/release-notes-generator",
+        ["@semantic-release/commit-analyzer", {parserOpts}],
+        ["@semantic-release/release-notes-generator", {parserOpts}],
         ["@semantic-release/github", {
             "assets": [
                 {"path": ".artifacts/documentation-darwin-amd64/documentation-darwin-amd64", "label": "Darwin x86_64"},
@@ -1,6 +1,11 @@
 module github.com/caos/documentation
 
-go 1.14
+go 1.19
 
-require github.com/fatih/structtag v1.2.0
+require (
+	github.com/fatih/structtag v1.2.0
+	golang.org/x/mod v0.20.0
+	sigs.k8s.io/yaml v1.3.0
+)
 
+require gopkg.in/yaml.v2 v2.4.0 // indirect
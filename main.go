@@ -5,13 +5,41 @@ import (
 	"fmt"
 	"github.com/caos/documentation/pkg/docu"
 	"os"
+	"strings"
 )
 
+// typeFlags collects repeated -type flags
+type typeFlags []string
+
+func (t *typeFlags) String() string {
+	return strings.Join(*t, ",")
+}
+
+func (t *typeFlags) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("expected type=representation, got %s", value)
+	}
+	*t = append(*t, value)
+	return nil
+}
+
 func main() {
-	var path, struc, md string
+	var path, struc, md, tags, goos, goarch, cacheDir, formats string
+	var verbose, failOnWarnings bool
+	var workers int
+	var knownTypes typeFlags
 	flag.StringVar(&path, "path", "", "The path to the go-file which contains the struct")
-	flag.StringVar(&struc, "struct", "", "The name of the struct for which the documentation should be generated")
+	flag.StringVar(&struc, "struct", "", "The name of the struct for which the documentation should be generated, a comma-separated list documents several structs")
 	flag.StringVar(&md, "output", "", "The path to the folder which should be used for the output")
+	flag.StringVar(&formats, "format", "yaml", "A comma-separated list of tag keys to read attribute names from, e.g. yaml,json uses json tags for fields without yaml tags")
+	flag.StringVar(&tags, "tags", "", "A comma-separated list of build tags to consider satisfied")
+	flag.StringVar(&goos, "goos", "", "The target operating system to select files for, defaults to $GOOS")
+	flag.StringVar(&goarch, "goarch", "", "The target architecture to select files for, defaults to $GOARCH")
+	flag.IntVar(&workers, "workers", 0, "The maximum number of structs documented and files parsed in parallel, defaults to the number of CPUs")
+	flag.StringVar(&cacheDir, "cache-dir", "", "A directory to keep parsed types in between runs, unchanged types are not parsed again")
+	flag.Var(&knownTypes, "type", "A type documented by its representation, e.g. time.Duration=\"duration string, e.g. 30s\", can be repeated")
+	flag.BoolVar(&verbose, "verbose", false, "Print which source directories are used for imported packages")
+	flag.BoolVar(&failOnWarnings, "fail-on-warnings", false, "Fail if warnings are found, e.g. for unresolved types")
 	flag.Parse()
 
 	if path == "" || struc == "" || md == "" {
@@ -19,7 +47,22 @@ func main() {
 	}
 
 	doc := docu.New()
-	if err := doc.Parse(path, struc); err != nil {
+	doc.SetVerbose(verbose)
+	doc.SetFailOnWarnings(failOnWarnings)
+	doc.SetWorkers(workers)
+	doc.SetCacheDir(cacheDir)
+	doc.SetFormats(splitList(formats)...)
+	for _, knownType := range knownTypes {
+		parts := strings.SplitN(knownType, "=", 2)
+		doc.RegisterType(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+
+	doc.SetBuildConstraints(goos, goarch, splitList(tags))
+	err := doc.ParseStructs(path, splitList(struc)...)
+	for _, diag := range doc.Diagnostics() {
+		fmt.Fprintln(os.Stderr, diag.String())
+	}
+	if err != nil {
 		fmt.Println(err.Error())
 		os.Exit(1)
 	}
@@ -31,3 +74,14 @@ func main() {
 
 	fmt.Println("Finished")
 }
+
+// splitList splits a comma-separated flag value and drops empty entries.
+func splitList(value string) []string {
+	list := make([]string, 0)
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
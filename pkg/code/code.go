@@ -1,15 +1,15 @@
 package code
 
 import (
+	"github.com/caos/documentation/pkg/diagnostics"
 	"github.com/caos/documentation/pkg/modules"
 	"github.com/caos/documentation/pkg/modules/pack"
 	"github.com/caos/documentation/pkg/object"
 	"github.com/caos/documentation/pkg/treeelement"
 	"go/ast"
-	"go/parser"
 	"go/token"
-	"io/ioutil"
-	"path/filepath"
+	"go/types"
+	"path"
 	"strings"
 )
 
@@ -29,390 +29,629 @@ var basicTypes []string = []string{
 	"uintptr",
 	"byte",
 	"rune",
+	"float32",
+	"float64",
+	"complex64",
+	"complex128",
+	"any",
+	"error",
 }
 
-func GetElementForStruct(packagePath string, structName string) (*treeelement.TreeElement, error) {
-	p := modules.CachedModule(packagePath).CachePackage(packagePath)
-	return recursiveGetElementForStruct(p, structName, nil)
+// Options decide how types are documented and where the packages and
+// elements are cached.
+type Options struct {
+	// Modules holds the packages and the elements built for them
+	Modules *modules.Cache
+	// Registry holds the types documented by their representation, the
+	// well-known types are used if it is nil
+	Registry *Registry
+	// Formats are the tag keys attribute names are read from, the first one a
+	// field has a tag for is used, yaml if empty
+	Formats []string
+	// CacheDir is the directory elements are persisted in between runs, empty disables it
+	CacheDir string
 }
 
-func recursiveGetElementForStruct(p *pack.Package, structName string, obj *object.Object) (*treeelement.TreeElement, error) {
+// GetElementForStruct builds the element tree for the struct, packages and
+// elements are taken from the caches and added to them.
+func GetElementForStruct(opts Options, packagePath string, structName string, diags *diagnostics.Diagnostics) (*treeelement.TreeElement, error) {
+	p := opts.Modules.Module(packagePath).CachePackage(packagePath)
+	w := newWalk(opts, diags)
+	element, err := recursiveGetElementForStruct(w, p, structName, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if element == nil {
+		w.errorf(token.Position{}, "type %s not found in %s", structName, packagePath)
+	}
+	return element, nil
+}
+
+// GetPackageDescription returns the package doc of the package for overview
+// pages, with its doc links qualified like the descriptions of the elements.
+func GetPackageDescription(opts Options, packagePath string, diags *diagnostics.Diagnostics) string {
+	p := opts.Modules.Module(packagePath).CachePackage(packagePath)
+	w := newWalk(opts, diags)
+	loadPackage(w, p)
+
+	doc := p.Doc()
+	if doc == nil {
+		return ""
+	}
+	return docObject(p, doc.Pos(), doc.Text()).GetDescription()
+}
+
+func isBasicType(name string) bool {
 	for _, basic := range basicTypes {
-		if basic == structName {
-			return nil, nil
+		if basic == name {
+			return true
 		}
 	}
+	return false
+}
 
-	treeElement, cached := p.CachedElements[structName]
-	if cached {
-		retTreeElement := objectToElement(obj, treeElement.GoType)
-		if treeElement.Collection {
-			retTreeElement.Collection = true
-		}
-		if treeElement.Map {
-			retTreeElement.Map = true
-		}
-		retTreeElement.SubElements = treeElement.SubElements
-		return retTreeElement, nil
+func recursiveGetElementForStruct(w *walk, p *pack.Package, structName string, typeArgs []*typeArgument, obj *object.Object) (*treeelement.TreeElement, error) {
+	if isBasicType(structName) {
+		return nil, nil
 	}
 
-	goFiles := p.GetGoFileList()
+	cacheKey := instanceKey(structName, typeArgs)
+	if w.isExpanding(p, cacheKey) {
+		// the type is already expanded further up, only reference it
+		retTreeElement := objectToElement(obj, instanceName(structName, typeArgs))
+		retTreeElement.GoPackagePath = p.BasePath
+		retTreeElement.GoImportPath = p.ImportPath
+		retTreeElement.Recursive = true
+		return retTreeElement, nil
+	}
 
-	for _, path := range goFiles {
-		treeElement, err := getElementForStructInFile(path, structName, obj)
-		if err != nil {
+	var treeElement *treeelement.TreeElement
+	if cached, found := p.CachedElement(w.elementKey(cacheKey)); found {
+		w.useCached(cached)
+		treeElement = cached.Element
+	} else {
+		var err error
+		treeElement, err = buildElement(w, p, structName, typeArgs, cacheKey)
+		if err != nil || treeElement == nil {
 			return nil, err
 		}
+	}
 
-		if treeElement != nil {
-			p.CachedElements[structName] = treeElement
-			return treeElement, nil
-		}
+	retTreeElement := objectToElement(obj, treeElement.GoType)
+	retTreeElement.GoPackagePath = treeElement.GoPackagePath
+	retTreeElement.GoImportPath = treeElement.GoImportPath
+	retTreeElement.Recursive = treeElement.Recursive
+	retTreeElement.TypeDescription = treeElement.TypeDescription
+	retTreeElement.Representation = treeElement.Representation
+	retTreeElement.TypeParameters = treeElement.TypeParameters
+	if treeElement.Collection {
+		retTreeElement.Collection = true
+	}
+	if treeElement.Map {
+		retTreeElement.Map = true
 	}
-	return nil, nil
+	retTreeElement.SubElements = treeElement.SubElements
+	return retTreeElement, nil
 }
 
-func getElementForStructInFile(path string, structName string, obj *object.Object) (*treeelement.TreeElement, error) {
-	src, file, err := parseFile(path)
-	if err != nil {
+// buildElement reads the element for the type from the disk cache or builds
+// it from the declaration. Elements which don't depend on types further up
+// and on packages with parse errors are cached.
+func buildElement(w *walk, p *pack.Package, structName string, typeArgs []*typeArgument, cacheKey string) (*treeelement.TreeElement, error) {
+	if cached := w.disk.load(w.modules, p, cacheKey); cached != nil {
+		p.CacheElement(w.elementKey(cacheKey), cached)
+		w.useCached(cached)
+		return cached.Element, nil
+	}
+
+	parseErrors := w.parseErrors
+	loadPackage(w, p)
+	w.depend(p.BasePath)
+	decl := p.TypeDeclaration(structName)
+	if decl == nil {
+		return nil, nil
+	}
+
+	w.trackDeps()
+	w.depend(p.BasePath)
+	start := len(w.reports)
+	complete := w.enter(p, cacheKey)
+	element, err := getElementForTypeDeclaration(w, p, decl, typeArgs)
+	cacheable := complete()
+	deps := w.untrackDeps()
+	if err != nil || element == nil {
 		return nil, err
 	}
 
-	imports := getImports(file)
+	if cacheable && w.parseErrors == parseErrors {
+		cached := &pack.CachedElement{
+			Element:     element,
+			Deps:        deps,
+			Diagnostics: w.relativeReports(start, w.attributePath()),
+		}
+		p.CacheElement(w.elementKey(cacheKey), cached)
+		w.disk.store(w.modules, p, cacheKey, cached)
+	}
+	return element, nil
+}
 
-	var element *treeelement.TreeElement
+// typeDoc returns the doc of a type, or the doc of its declaration if it is declared alone.
+func typeDoc(decl *pack.TypeDeclaration) string {
+	doc := decl.Spec.Doc
+	if doc == nil && len(decl.Decl.Specs) == 1 {
+		doc = decl.Decl.Doc
+	}
+	if doc == nil {
+		return ""
+	}
+	return doc.Text()
+}
+
+// typeDescription returns the doc of the type without markers. Besides the
+// godoc convention "Foo is ..." docs starting with "Foo:" are supported, they
+// can also be written on a declaration of several types.
+func typeDescription(decl *pack.TypeDeclaration) string {
+	prefix := strings.Join([]string{decl.Spec.Name.Name, ":"}, "")
+	doc := typeDoc(decl)
+	if strings.TrimSpace(doc) == "" && decl.Decl.Doc != nil && strings.HasPrefix(decl.Decl.Doc.Text(), prefix) {
+		doc = decl.Decl.Doc.Text()
+	}
+	doc = strings.TrimSpace(object.StripMarkers(doc))
+	return strings.TrimSpace(strings.TrimPrefix(doc, prefix))
+}
 
-	typeComments := make([]string, 0)
-	for _, node := range file.Decls {
-		gd, ok := node.(*ast.GenDecl)
-		if ok && gd.Doc != nil {
-			commentText := make([]string, 0)
-			for _, comment := range gd.Doc.List {
-				trimed := strings.TrimSpace(strings.TrimPrefix(strings.TrimSuffix(strings.TrimPrefix(comment.Text, "/*"), "*/"), "//"))
-				commentText = append(commentText, trimed)
+func getElementForTypeDeclaration(w *walk, p *pack.Package, decl *pack.TypeDeclaration, typeArgs []*typeArgument) (*treeelement.TreeElement, error) {
+	t := decl.Spec
+	element := objectToElement(nil, instanceName(t.Name.Name, typeArgs))
+	element.GoPackagePath = p.BasePath
+	element.GoImportPath = p.ImportPath
+	element.TypeDescription = object.QualifyDocLinks(typeDescription(decl), p.ImportPath, fileImports(p, decl.File), lookupSym(p))
+
+	// if generic type
+	scope := typeScope{}
+	if t.TypeParams != nil {
+		idx := 0
+		for _, field := range t.TypeParams.List {
+			for _, name := range field.Names {
+				if idx < len(typeArgs) {
+					scope[name.Name] = typeArgs[idx]
+				} else {
+					element.TypeParameters = append(element.TypeParameters, &treeelement.TypeParameter{
+						Name:       name.Name,
+						Constraint: types.ExprString(field.Type),
+					})
+				}
+				idx++
 			}
-			typeComments = append(typeComments, strings.Join(commentText, " "))
 		}
 	}
 
-	ast.Inspect(file, func(x ast.Node) bool {
-		// when type definition
-		t, okt := x.(*ast.TypeSpec)
-		if !okt || structName != t.Name.Name {
-			return true
-		}
-		// when struct
-		s, oks := t.Type.(*ast.StructType)
-		a, oka := t.Type.(*ast.ArrayType)
-		sel, oksel := t.Type.(*ast.SelectorExpr)
-		if !oks && !oka && !oksel {
-			return true
+	// if struct type
+	if s, ok := t.Type.(*ast.StructType); ok {
+		subElements, err := getElementsForFields(w, p, s, scope, getDefaults(p, t.Name.Name))
+		if err != nil {
+			return nil, err
 		}
+		element.SubElements = append(element.SubElements, subElements...)
+		return element, nil
+	}
 
-		element = objectToElement(obj, t.Name.Name)
-		if t.Doc != nil && t.Doc.Text() != "" {
-			element.TypeDescription = t.Doc.Text()
-		}
-		prefix := strings.Join([]string{t.Name.Name, ":"}, "")
-		for _, comment := range typeComments {
-			if strings.HasPrefix(comment, prefix) {
-				element.TypeDescription = strings.TrimPrefix(comment, prefix)
+	// if type of another type, e.g. a collection or a type from another package
+	bound := scope.bind(p, resolveFieldType(p.Info(), t.Type))
+	ft := bound.ft
+	pos := p.Fset().Position(t.Type.Pos())
+	if ft.freeForm {
+		element.Collection = ft.collection
+		element.Map = ft.mp
+		element.Representation = ft.freeFormRepresentation()
+		return element, nil
+	}
+	if ft.typeParam {
+		return nil, nil
+	}
+	if ft.leaf {
+		return leafElement(p, element, t.Name.Name, ft), nil
+	}
+	if ft.unresolved {
+		w.warnf(pos, "unresolved package of type %s", bound.display())
+		return nil, nil
+	}
+	if representation, found := w.registry.Lookup(qualifiedImportPath(bound), ft.name); found {
+		element.Collection = ft.collection
+		element.Map = ft.mp
+		element.Representation = representation
+		return element, nil
+	}
+
+	fieldObj := &object.Object{
+		Fieldname:  t.Name.Name,
+		Collection: ft.collection,
+		MapType:    ft.mp,
+		Mapkey:     ft.mapKey,
+	}
+	fieldPackage := packageForFieldType(w, bound.p, ft, fieldObj)
+	if fieldPackage == nil {
+		w.warnf(pos, "unresolved import %s of type %s", ft.importPath, bound.display())
+		return nil, nil
+	}
+	subElement, err := recursiveGetElementForStruct(w, fieldPackage, ft.name, bound.args, fieldObj)
+	if err != nil {
+		return nil, err
+	}
+	if subElement == nil {
+		if ft.importPath != "" && !isBasicType(ft.name) {
+			if _, found, err := getEnumForType(w, fieldPackage, ft.name, true); err != nil {
+				return nil, err
+			} else if !found {
+				w.warnf(pos, "unresolved type %s", bound.display())
+				return nil, nil
 			}
 		}
+		return leafElement(p, element, t.Name.Name, ft), nil
+	}
 
-		// if type of a type
-		if sel != nil {
-			fieldObj := &object.Object{}
-			identX := sel.X.(*ast.Ident)
+	element.Collection = ft.collection || subElement.Collection
+	element.Map = ft.mp || subElement.Map
+	if subElement.Recursive {
+		// reference the expanding type instead of this one
+		element.GoType = subElement.GoType
+		element.GoPackagePath = subElement.GoPackagePath
+		element.GoImportPath = subElement.GoImportPath
+		element.Recursive = true
+	}
+	if subElement.SubElements != nil {
+		element.SubElements = append(element.SubElements, subElement.SubElements...)
+	}
+	return element, nil
+}
 
-			fieldObj.Fieldname = structName
+// leafElement documents a named type which is no struct and doesn't resolve
+// to one, e.g. type Values map[string][]string or type Reader interface{...},
+// as leaf with the collection and map flags of its underlying type. Named
+// scalar types are documented by their constants instead, so nil is returned.
+func leafElement(p *pack.Package, element *treeelement.TreeElement, name string, ft *fieldType) *treeelement.TreeElement {
+	element.Collection = ft.collection
+	element.Map = ft.mp
+	if p.Types() == nil {
+		return element
+	}
+	typeName, ok := p.Types().Scope().Lookup(name).(*types.TypeName)
+	if !ok {
+		return element
+	}
 
-			importPath := modules.CachedModule(path).GetPathForImport(imports[identX.Name])
-			fieldObj.PackageName = filepath.Base(importPath)
-			subElement, err := recursiveGetElementForStruct(modules.CachedModule(importPath).CachePackage(importPath), sel.Sel.Name, fieldObj)
-			if err != nil {
-				return false
-			}
-			if subElement != nil {
-				element.Collection = subElement.Collection
-				element.Map = subElement.Map
-				if subElement.SubElements != nil {
-					element.SubElements = append(element.SubElements, subElement.SubElements...)
-				}
-			}
-			return true
+	switch u := typeName.Type().Underlying().(type) {
+	case *types.Basic:
+		// invalid if the underlying type is declared in an imported package,
+		// which the stub importer doesn't provide
+		if u.Kind() != types.Invalid || !ft.leaf && ft.prefix == "" {
+			return nil
 		}
+	case *types.Slice, *types.Array:
+		element.Collection = true
+	case *types.Map:
+		element.Map = true
+	}
+	return element
+}
 
-		// if array type
-		if a != nil {
-			fieldObj := &object.Object{}
-			sel, oksel := a.Elt.(*ast.SelectorExpr)
-			i, oki := a.Elt.(*ast.Ident)
+func getElementsForFields(w *walk, p *pack.Package, s *ast.StructType, scope typeScope, defaults map[string]*fieldDefault) ([]*treeelement.TreeElement, error) {
+	elements := make([]*treeelement.TreeElement, 0)
+	// formats of the fields the elements are built for
+	formats := make([]string, 0)
+	imports, symbols := fileImports(p, fileOf(p, s.Pos())), lookupSym(p)
 
-			if oksel {
-				identX := sel.X.(*ast.Ident)
+	for _, field := range s.Fields.List {
+		bound := scope.bind(p, resolveFieldType(p.Info(), field.Type))
+		ft := bound.ft
+		pos := p.Fset().Position(field.Type.Pos())
 
-				fieldObj.Fieldname = structName
-				fieldObj.Collection = true
+		names := make([]string, 0)
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+		if len(names) == 0 {
+			// embedded fields are named after their type
+			names = append(names, ft.name)
+		}
 
-				importPath := modules.CachedModule(path).GetPathForImport(imports[identX.Name])
-				fieldObj.PackageName = filepath.Base(importPath)
-				subElement, err := recursiveGetElementForStruct(modules.CachedModule(importPath).CachePackage(importPath), sel.Sel.Name, fieldObj)
-				if err != nil {
-					return false
-				}
-				if subElement != nil {
-					if subElement.SubElements != nil {
-						element.Map = subElement.Map
-						element.Collection = subElement.Collection
-						element.SubElements = append(element.SubElements, subElement.SubElements...)
-					}
-				}
-				return true
+		// fields declared together like "Host, Port string" share doc, tag and type
+		for _, name := range names {
+			// decoders can't set unexported fields, the exported fields of embedded ones are promoted
+			if len(field.Names) > 0 && !ast.IsExported(name) {
+				continue
 			}
 
-			if oki {
-				ty := i.Obj.Decl.(*ast.TypeSpec)
-				sel, oksel := ty.Type.(*ast.SelectorExpr)
-				strc, oks := ty.Type.(*ast.StructType)
-				if !oks && oksel {
-					identX := sel.X.(*ast.Ident)
-
-					fieldObj.Fieldname = structName
-					fieldObj.Collection = true
-
-					importPath := modules.CachedModule(path).GetPathForImport(imports[identX.Name])
-					fieldObj.PackageName = filepath.Base(importPath)
-					subElement, err := recursiveGetElementForStruct(modules.CachedModule(importPath).CachePackage(importPath), sel.Sel.Name, fieldObj)
-					if err != nil {
-						return false
-					}
-					if subElement != nil {
-						if subElement.SubElements != nil {
-							element.Map = subElement.Map
-							element.Collection = subElement.Collection
-							element.SubElements = append(element.SubElements, subElement.SubElements...)
-						}
-					}
-					return true
-				}
-
-				for _, field := range strc.Fields.List {
-					fieldObj := &object.Object{}
-					if field.Doc != nil && field.Doc.Text() != "" {
-						fieldObj.Comments = field.Doc.Text()
-					}
-					if field.Tag != nil && field.Tag.Value != "" {
-						fieldObj.Tag = field.Tag.Value
-					}
-
-					v, i, t, _, c, m, mkey := getVariableFromField(src, field)
-					fieldObj.Fieldname = v
-					fieldObj.Collection = c
-					fieldObj.Mapkey = mkey
-					fieldObj.MapType = m
-
-					if i != "" {
-						importPath := modules.CachedModule(path).GetPathForImport(imports[i])
-						fieldObj.PackageName = filepath.Base(importPath)
-						subElement, err := recursiveGetElementForStruct(modules.CachedModule(importPath).CachePackage(importPath), t, fieldObj)
-						if err != nil {
-							return false
-						}
-						if subElement != nil {
-							if subElement.Inline {
-								if subElement.SubElements != nil {
-									element.SubElements = append(element.SubElements, subElement.SubElements...)
-								}
-							} else {
-								element.SubElements = append(element.SubElements, subElement)
-							}
-						}
-					} else {
-						dir := filepath.Dir(path)
-						subElement, err := recursiveGetElementForStruct(modules.CachedModule(dir).CachePackage(dir), t, fieldObj)
-						if err != nil {
-							return false
-						}
-						if subElement != nil {
-							// another struct type
-							element.SubElements = append(element.SubElements, subElement)
-						} else {
-							// basic types
-							element.SubElements = append(element.SubElements, objectToElement(fieldObj, t))
-						}
-					}
-				}
-				return true
+			fieldObj := &object.Object{
+				Fieldname:  name,
+				Collection: ft.collection,
+				MapType:    ft.mp,
+				Mapkey:     ft.mapKey,
+				Pointer:    ft.pointer,
+				Embedded:   len(field.Names) == 0,
+				ImportPath: p.ImportPath,
+				Imports:    imports,
+				LookupSym:  symbols,
 			}
-		}
-
-		//if struct type
-		for _, field := range s.Fields.List {
-			fieldObj := &object.Object{}
 			if field.Doc != nil && field.Doc.Text() != "" {
 				fieldObj.Comments = field.Doc.Text()
 			}
 			if field.Tag != nil && field.Tag.Value != "" {
 				fieldObj.Tag = field.Tag.Value
 			}
+			fieldObj.Format = fieldObj.SelectFormat(w.formats)
+			annotations := fieldObj.GetAnnotations()
+			if fieldObj.IsIgnored(fieldObj.Format) || annotations.Hidden {
+				continue
+			}
 
-			v, i, t, _, c, m, mkey := getVariableFromField(src, field)
-			fieldObj.Fieldname = v
-			fieldObj.Collection = c
-			fieldObj.Mapkey = mkey
-			fieldObj.MapType = m
-
-			if i != "" {
-				importPath := modules.CachedModule(path).GetPathForImport(imports[i])
-				fieldObj.PackageName = filepath.Base(importPath)
-				subElement, err := recursiveGetElementForStruct(modules.CachedModule(importPath).CachePackage(importPath), t, fieldObj)
-				if err != nil {
-					return false
-				}
-				if subElement != nil {
-					if subElement.Inline {
-						if subElement.SubElements != nil {
-							element.SubElements = append(element.SubElements, subElement.SubElements...)
-						}
-					} else {
-						element.SubElements = append(element.SubElements, subElement)
-					}
-				}
-			} else {
-				dir := filepath.Dir(path)
-				subElement, err := recursiveGetElementForStruct(modules.CachedModule(dir).CachePackage(dir), t, fieldObj)
-				if err != nil {
-					return false
-				}
-				if subElement != nil {
-					if subElement.Inline {
-						if subElement.SubElements != nil {
-							element.SubElements = append(element.SubElements, subElement.SubElements...)
-						}
-					} else {
-						// another struct type
-						element.SubElements = append(element.SubElements, subElement)
-					}
-				} else {
-					// basic types
-					element.SubElements = append(element.SubElements, objectToElement(fieldObj, t))
+			w.push(attributeName(fieldObj))
+			for _, unknown := range annotations.Unknown {
+				w.warnf(p.Fset().Position(field.Pos()), "unknown directive @%s", unknown)
+			}
+			if def, found := defaults[name]; found {
+				annotated := strings.Trim(strings.TrimSpace(fieldObj.GetDefaultValue()), `"`)
+				if annotated != "" && annotated != def.value {
+					w.warnf(p.Fset().Position(field.Pos()), "default %s set at %s differs from the annotated default %s", def.value, def.pos, annotated)
 				}
+				fieldObj.Default = def.value
+			}
+			if _, err := fieldObj.GetDefaultData(); err != nil {
+				w.warnf(p.Fset().Position(field.Pos()), "block default is no valid YAML, it is only documented as text: %v", err)
+			}
+			fieldElements, err := getElementsForField(w, bound, scope, fieldObj, pos)
+			w.pop()
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, fieldElements...)
+			for range fieldElements {
+				formats = append(formats, fieldObj.Format)
 			}
 		}
-		return false
-	})
-	return element, nil
+	}
+	return resolvePromoted(w, p, s, elements, formats), nil
 }
 
-func objectToElement(obj *object.Object, ty string) *treeelement.TreeElement {
-	element := &treeelement.TreeElement{
-		GoType:      ty,
-		SubElements: make([]*treeelement.TreeElement, 0),
+// resolvePromoted keeps one of the attributes with the same name, the way the
+// encoder of the format of their fields does it. The attributes of the
+// shallowest embedded structs win, encoding/json and toml prefer a tagged one
+// of these and drop all of them if it is still ambiguous. yaml fails to decode
+// structs with duplicate inlined attributes, which is warned about.
+func resolvePromoted(w *walk, p *pack.Package, s *ast.StructType, elements []*treeelement.TreeElement, formats []string) []*treeelement.TreeElement {
+	byName := map[string][]int{}
+	for i, element := range elements {
+		if element != nil {
+			byName[element.AttributeName] = append(byName[element.AttributeName], i)
+		}
 	}
-	format := "yaml"
 
-	if obj != nil {
-		element.FieldDescription = obj.GetDescription()
-		attrName := obj.GetAttributeName(format)
-		if attrName != "" {
-			element.AttributeName = attrName
-		} else {
-			element.AttributeName = obj.GetFieldName()
+	dropped := map[int]bool{}
+	for i, element := range elements {
+		if element == nil {
+			continue
+		}
+		indices := byName[element.AttributeName]
+		if len(indices) < 2 || indices[0] != i {
+			continue
+		}
+
+		dominant := shallowest(elements, indices)
+		switch format := formats[i]; format {
+		case "json", "toml":
+			if len(dominant) > 1 {
+				dominant = tagged(elements, dominant)
+			}
+			if len(dominant) > 1 {
+				w.warnf(p.Fset().Position(s.Pos()), "attribute %s is ambiguous, %s drops it", element.AttributeName, format)
+				dominant = nil
+			}
+		case "yaml":
+			w.warnf(p.Fset().Position(s.Pos()), "attribute %s is defined %d times, yaml fails to decode it", element.AttributeName, len(indices))
+		}
+
+		for _, idx := range indices {
+			if len(dominant) == 0 || idx != dominant[0] {
+				dropped[idx] = true
+			}
 		}
-		element.DefaultValue = obj.GetDefaultValue()
-		element.GoName = obj.GetFieldName()
-		element.GoPackage = obj.GetPackageName()
-		element.Collection = obj.IsCollection()
-		element.Inline = obj.IsInline(format)
-		element.Map = obj.MapType
 	}
-	return element
-}
 
-func parseFile(path string) ([]byte, *ast.File, error) {
-	src, err := ioutil.ReadFile(path)
-	if err != nil {
-		return nil, nil, err
+	resolved := make([]*treeelement.TreeElement, 0, len(elements))
+	for i, element := range elements {
+		if !dropped[i] {
+			resolved = append(resolved, element)
+		}
 	}
+	return resolved
+}
 
-	fset := token.NewFileSet()
-	file, err := parser.ParseFile(fset, "demo", src, parser.ParseComments)
-	if err != nil {
-		return nil, nil, err
+// shallowest returns the attributes which are promoted from the least deeply embedded structs.
+func shallowest(elements []*treeelement.TreeElement, indices []int) []int {
+	depth := -1
+	for _, idx := range indices {
+		if depth < 0 || elements[idx].PromotionDepth < depth {
+			depth = elements[idx].PromotionDepth
+		}
 	}
 
-	return src, file, nil
+	found := make([]int, 0, len(indices))
+	for _, idx := range indices {
+		if elements[idx].PromotionDepth == depth {
+			found = append(found, idx)
+		}
+	}
+	return found
 }
 
-func getImports(file *ast.File) map[string]string {
-	imports := make(map[string]string, 0)
-	for _, imp := range file.Imports {
-		name := filepath.Base(strings.TrimPrefix(strings.TrimSuffix(imp.Path.Value, "\""), "\""))
-		if imp.Name != nil && imp.Name.Name != "" {
-			name = imp.Name.Name
+// tagged returns the tagged attributes, or all of them if none is tagged.
+func tagged(elements []*treeelement.TreeElement, indices []int) []int {
+	found := make([]int, 0, len(indices))
+	for _, idx := range indices {
+		if elements[idx].Tagged {
+			found = append(found, idx)
 		}
-		imports[name] = strings.TrimPrefix(strings.TrimSuffix(imp.Path.Value, "\""), "\"")
 	}
-	return imports
+	if len(found) == 0 {
+		return indices
+	}
+	return found
 }
 
-func getVariableFromField(src []byte, field *ast.Field) (varName string, impName string, typeName string, pointer bool, slice bool, mp bool, mapKeyType string) {
-	fieldInSource := string(src[field.Pos()-1 : field.End()-1])
+func getElementsForField(w *walk, bound *typeArgument, scope typeScope, fieldObj *object.Object, pos token.Position) ([]*treeelement.TreeElement, error) {
+	ft := bound.ft
+	if ft.fields != nil {
+		return getElementsForAnonymousStruct(w, bound, scope, fieldObj)
+	}
+	// type parameters are only left unbound when documenting the generic declaration itself
+	if ft.leaf || ft.typeParam {
+		element := objectToElement(fieldObj, ft.name)
+		if ft.freeForm {
+			element.Representation = ft.freeFormRepresentation()
+		}
+		return []*treeelement.TreeElement{element}, nil
+	}
+	if ft.unresolved {
+		w.warnf(pos, "unresolved package of type %s", bound.display())
+		return nil, nil
+	}
+	if representation, found := w.registry.Lookup(qualifiedImportPath(bound), ft.name); found {
+		element := objectToElement(fieldObj, ft.name)
+		element.Representation = representation
+		return []*treeelement.TreeElement{element}, nil
+	}
+
+	fieldPackage := packageForFieldType(w, bound.p, ft, fieldObj)
+	if fieldPackage == nil {
+		w.warnf(pos, "unresolved import %s of type %s", ft.importPath, bound.display())
+		return nil, nil
+	}
+	subElement, err := recursiveGetElementForStruct(w, fieldPackage, ft.name, bound.args, fieldObj)
+	if err != nil {
+		return nil, err
+	}
 
-	parts := strings.Split(fieldInSource, " ")
-	copyParts := make([]string, 0)
-	for _, part := range parts {
-		if part != "" {
-			copyParts = append(copyParts, part)
+	if subElement == nil {
+		if isBasicType(ft.name) {
+			// basic types
+			return []*treeelement.TreeElement{objectToElement(fieldObj, ft.name)}, nil
 		}
+
+		// named scalar types, possibly with constants as allowed values, other
+		// named types are resolved above, so the type isn't declared
+		enum, found, err := getEnumForType(w, fieldPackage, ft.name, ft.importPath != "")
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			element := objectToElement(fieldObj, ft.name)
+			if len(enum) > 0 && len(element.Enum) == 0 {
+				element.Enum = enum
+			}
+			return []*treeelement.TreeElement{element}, nil
+		}
+		w.warnf(pos, "unresolved type %s", bound.display())
+		return nil, nil
 	}
 
-	startTrim := false
-	parts = make([]string, 0)
-	for _, part := range copyParts {
-		if strings.HasPrefix(part, "`") {
-			startTrim = true
+	if subElement.Inline {
+		if !fieldObj.Embedded {
+			return subElement.SubElements, nil
 		}
-		if !startTrim {
-			parts = append(parts, part)
+		// the elements are shared through the caches, so the promoted ones are copies
+		promoted := make([]*treeelement.TreeElement, 0, len(subElement.SubElements))
+		for _, element := range subElement.SubElements {
+			if element == nil {
+				continue
+			}
+			copied := *element
+			if copied.PromotedFrom == "" {
+				copied.PromotedFrom = strings.TrimPrefix(bound.display(), ft.prefix)
+			}
+			copied.PromotionDepth++
+			promoted = append(promoted, &copied)
 		}
+		return promoted, nil
 	}
+	// another struct type
+	return []*treeelement.TreeElement{subElement}, nil
+}
 
-	inlineType := ""
-	if len(parts) >= 2 {
-		varName = parts[0]
-		inlineType = parts[1]
-	} else if len(parts) < 2 {
-		varName = ""
-		inlineType = parts[0]
+// getElementsForAnonymousStruct expands the fields of an anonymous struct like
+// the ones of a declared struct, the element is named after the field as the
+// struct has no name.
+func getElementsForAnonymousStruct(w *walk, bound *typeArgument, scope typeScope, fieldObj *object.Object) ([]*treeelement.TreeElement, error) {
+	subElements, err := getElementsForFields(w, bound.p, bound.ft.fields, scope, map[string]*fieldDefault{})
+	if err != nil {
+		return nil, err
 	}
 
-	if strings.HasPrefix(inlineType, "map") {
-		inlineType = strings.TrimPrefix(inlineType, "map")
-		mp = true
-		typeParts := strings.SplitAfter(inlineType, "]")
-		mapKeyType = strings.TrimPrefix(strings.TrimSuffix(typeParts[0], "]"), "[")
-		inlineType = strings.TrimPrefix(inlineType, typeParts[0])
+	element := objectToElement(fieldObj, treeelement.AnonymousStruct)
+	if element.Inline {
+		return subElements, nil
 	}
+	element.GoPackagePath = bound.p.BasePath
+	element.GoImportPath = bound.p.ImportPath
+	element.SubElements = subElements
+	return []*treeelement.TreeElement{element}, nil
+}
 
-	if strings.HasPrefix(inlineType, "[]") {
-		inlineType = strings.TrimPrefix(inlineType, "[]")
-		slice = true
+// qualifiedImportPath returns the import path of the package declaring the type.
+func qualifiedImportPath(bound *typeArgument) string {
+	if bound.ft.importPath != "" {
+		return bound.ft.importPath
 	}
+	return bound.p.ImportPath
+}
 
-	if strings.HasPrefix(inlineType, "*") {
-		inlineType = strings.TrimPrefix(inlineType, "*")
-		pointer = true
+func packageForFieldType(w *walk, p *pack.Package, ft *fieldType, fieldObj *object.Object) *pack.Package {
+	if ft.importPath == "" {
+		return p
 	}
 
-	typeParts := strings.Split(inlineType, ".")
-	if len(typeParts) > 1 {
-		impName = typeParts[0]
-		typeName = typeParts[1]
-	} else {
-		typeName = typeParts[0]
+	importPath := w.modules.Module(p.BasePath).GetPathForImport(ft.importPath)
+	if importPath == "" {
+		return nil
+	}
+	fieldObj.PackageName = path.Base(ft.importPath)
+	return w.modules.Module(importPath).CachePackage(importPath)
+}
+
+func objectToElement(obj *object.Object, ty string) *treeelement.TreeElement {
+	element := &treeelement.TreeElement{
+		GoType:      ty,
+		SubElements: make([]*treeelement.TreeElement, 0),
+	}
+	if obj != nil {
+		element.FieldDescription = obj.GetDescription()
+		element.AttributeName = attributeName(obj)
+		element.Tagged = obj.IsTagged(obj.Format)
+		element.DefaultValue, element.DefaultBlock = obj.GetDefault()
+		element.DefaultData, _ = obj.GetDefaultData()
+		element.GoName = obj.GetFieldName()
+		element.GoPackage = obj.GetPackageName()
+		element.Collection = obj.IsCollection()
+		element.Inline = obj.IsInline(obj.Format)
+		element.Required = obj.IsRequired(obj.Format)
+		element.Constraints = obj.GetConstraints()
+		if enum := obj.GetEnum(); len(enum) > 0 {
+			element.Enum = enum
+		}
+		annotations := obj.GetAnnotations()
+		element.Example = annotations.Example
+		element.Deprecated = annotations.Deprecated
+		element.DeprecationNote = annotations.DeprecationNote
+		element.Since = annotations.Since
+		element.See = annotations.See
+		element.Map = obj.MapType
 	}
+	return element
+}
 
-	return
+func attributeName(obj *object.Object) string {
+	attrName := obj.GetAttributeName(obj.Format)
+	if attrName != "" {
+		return attrName
+	}
+	return obj.GetFieldName()
 }
@@ -0,0 +1,209 @@
+package code
+
+import (
+	"github.com/caos/documentation/pkg/diagnostics"
+	"github.com/caos/documentation/pkg/modules"
+	"github.com/caos/documentation/pkg/treeelement"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// treeTest documents a struct of the testdata package and compares the
+// rendered tree and the diagnostics.
+type treeTest struct {
+	name        string
+	structName  string
+	formats     []string
+	want        string
+	diagnostics []string
+}
+
+func runTreeTests(t *testing.T, tests []treeTest) {
+	t.Helper()
+	path, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diags := diagnostics.New()
+			element, err := GetElementForStruct(Options{Modules: modules.NewCache(), Formats: tt.formats}, path, tt.structName, diags)
+			if err != nil {
+				t.Fatalf("GetElementForStruct() error = %v", err)
+			}
+			if element == nil {
+				t.Fatalf("GetElementForStruct() found no element")
+			}
+			if got := tree(element, ""); got != tt.want {
+				t.Errorf("GetElementForStruct() =\n%s\nwant\n%s", got, tt.want)
+			}
+
+			messages := make([]string, 0)
+			for _, diag := range diags.List() {
+				messages = append(messages, diag.Message)
+			}
+			if want := append([]string{}, tt.diagnostics...); !reflect.DeepEqual(messages, want) {
+				t.Errorf("diagnostics = %q, want %q", messages, want)
+			}
+		})
+	}
+}
+
+// tree renders the attributes of an element, one line per attribute with its
+// type and flags, the attributes of its type are indented below it.
+func tree(element *treeelement.TreeElement, indent string) string {
+	lines := make([]string, 0)
+	for _, sub := range element.SubElements {
+		line := []string{sub.AttributeName, sub.GoType}
+		if sub.Collection {
+			line = append(line, "collection")
+		}
+		if sub.Map {
+			line = append(line, "map")
+		}
+		if sub.Required {
+			line = append(line, "required")
+		}
+		if sub.Recursive {
+			line = append(line, "recursive")
+		}
+		if sub.PromotedFrom != "" {
+			line = append(line, "from "+sub.PromotedFrom)
+		}
+		for _, value := range sub.Enum {
+			line = append(line, "enum "+value.Value)
+		}
+		lines = append(lines, indent+strings.Join(line, " ")+"\n")
+		if !sub.Recursive {
+			lines = append(lines, tree(sub, indent+"  "))
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+func TestFieldTypes(t *testing.T) {
+	runTreeTests(t, []treeTest{
+		{
+			name:       "type expressions",
+			structName: "Fields",
+			want: `pointers Foo map required
+  name string required
+callback func() required
+events chan Foo required
+matrix Foo collection required
+  name string required
+items Item collection map required
+  id string required
+handler func(name string, count int) error required
+network struct required
+  port int required
+`,
+		},
+	})
+}
+
+func TestSeveralNames(t *testing.T) {
+	runTreeTests(t, []treeTest{
+		{
+			name:       "one attribute per exported name",
+			structName: "Names",
+			want: `host string required
+port string required
+b int required
+`,
+		},
+	})
+}
+
+func TestGenerics(t *testing.T) {
+	runTreeTests(t, []treeTest{
+		{
+			name:       "instantiations",
+			structName: "Generics",
+			want: `nodes List[Node] required
+  items Node collection required
+    value string required
+  first Node required
+    value string required
+names List[string] required
+  items string collection required
+  first string required
+`,
+		},
+		{
+			name:       "generic declaration",
+			structName: "List",
+			want: `items T collection required
+first T required
+`,
+		},
+	})
+}
+
+func TestEnums(t *testing.T) {
+	runTreeTests(t, []treeTest{
+		{
+			name:       "const block",
+			structName: "Enums",
+			want: `level Level required enum debug enum info
+`,
+		},
+	})
+}
+
+func TestRecursiveTypes(t *testing.T) {
+	runTreeTests(t, []treeTest{
+		{
+			name:       "self-referential",
+			structName: "Tree",
+			want: `name string required
+children Tree collection required recursive
+`,
+		},
+		{
+			name:       "mutually recursive",
+			structName: "Ping",
+			want: `pong Pong
+  ping Ping recursive
+`,
+		},
+	})
+}
+
+func TestEmbedding(t *testing.T) {
+	runTreeTests(t, []treeTest{
+		{
+			name:       "json drops ambiguous attributes",
+			structName: "Embedded",
+			formats:    []string{"json"},
+			want: `name string required from Common
+owner string required from Meta
+extra string required
+`,
+			diagnostics: []string{"attribute kind is ambiguous, json drops it"},
+		},
+		{
+			name:       "yaml inline",
+			structName: "Embedded",
+			formats:    []string{"yaml"},
+			want: `name string required from Common
+kind string required from Common
+owner string required from Meta
+extra string required
+`,
+			diagnostics: []string{"attribute kind is defined 2 times, yaml fails to decode it"},
+		},
+		{
+			name:       "mapstructure squash",
+			structName: "Embedded",
+			formats:    []string{"mapstructure"},
+			want: `name string required from Common
+kind string required from Common
+owner string required from Meta
+extra string required
+`,
+		},
+	})
+}
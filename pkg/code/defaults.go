@@ -0,0 +1,161 @@
+package code
+
+import (
+	"github.com/caos/documentation/pkg/modules/pack"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// defaultMethods are the methods which set the defaults of their receiver
+var defaultMethods = []string{"SetDefaults", "SetDefault", "Defaults", "Default"}
+
+// defaultPrefixes are the prefixes of constructors and variables which hold defaults
+var defaultPrefixes = []string{"New", "Default", "default"}
+
+// fieldDefault is a default of a field found in the code.
+type fieldDefault struct {
+	value string
+	pos   token.Position
+}
+
+// getDefaults returns the defaults of the fields of the struct type by their
+// field name. They are read from constant values assigned in methods like
+// SetDefaults, in constructors like NewConfig and in composite literals of
+// variables like DefaultConfig. The first default found for a field is used.
+func getDefaults(p *pack.Package, typeName string) map[string]*fieldDefault {
+	defaults := map[string]*fieldDefault{}
+	if p.Types() == nil {
+		return defaults
+	}
+	typeObj, ok := p.Types().Scope().Lookup(typeName).(*types.TypeName)
+	if !ok {
+		return defaults
+	}
+	named, ok := typeObj.Type().(*types.Named)
+	if !ok {
+		return defaults
+	}
+
+	for _, file := range p.Files() {
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if d.Body != nil && isDefaultFunc(p.Info(), d, named) {
+					collectDefaults(p, d.Body, named, defaults)
+				}
+			case *ast.GenDecl:
+				if d.Tok != token.VAR {
+					continue
+				}
+				for _, spec := range d.Specs {
+					vs, ok := spec.(*ast.ValueSpec)
+					if !ok {
+						continue
+					}
+					for i, name := range vs.Names {
+						if i < len(vs.Values) && hasAnyPrefix(name.Name, defaultPrefixes) {
+							collectDefaults(p, vs.Values[i], named, defaults)
+						}
+					}
+				}
+			}
+		}
+	}
+	return defaults
+}
+
+// isDefaultFunc checks if the function is a method setting the defaults of
+// the type or a constructor returning it.
+func isDefaultFunc(info *types.Info, fd *ast.FuncDecl, named *types.Named) bool {
+	if fd.Recv != nil {
+		if len(fd.Recv.List) == 0 || !containsString(defaultMethods, fd.Name.Name) {
+			return false
+		}
+		return isType(info.TypeOf(fd.Recv.List[0].Type), named)
+	}
+
+	if !hasAnyPrefix(fd.Name.Name, defaultPrefixes) || fd.Type.Results == nil {
+		return false
+	}
+	for _, result := range fd.Type.Results.List {
+		if isType(info.TypeOf(result.Type), named) {
+			return true
+		}
+	}
+	return false
+}
+
+// collectDefaults adds the constant values of fields of the type which are
+// assigned or set in composite literals in node.
+func collectDefaults(p *pack.Package, node ast.Node, named *types.Named, defaults map[string]*fieldDefault) {
+	info := p.Info()
+	add := func(field string, value ast.Expr) {
+		if _, found := defaults[field]; found {
+			return
+		}
+		tv, ok := info.Types[value]
+		if !ok || tv.Value == nil {
+			return
+		}
+		defaults[field] = &fieldDefault{value: constantValue(tv.Value), pos: p.Fset().Position(value.Pos())}
+	}
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch e := n.(type) {
+		case *ast.CompositeLit:
+			if !isType(info.TypeOf(e), named) {
+				return true
+			}
+			for _, elt := range e.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					if key, ok := kv.Key.(*ast.Ident); ok {
+						add(key.Name, kv.Value)
+					}
+				}
+			}
+		case *ast.AssignStmt:
+			if len(e.Lhs) != len(e.Rhs) {
+				return true
+			}
+			for i, lhs := range e.Lhs {
+				if sel, ok := lhs.(*ast.SelectorExpr); ok && isType(info.TypeOf(sel.X), named) {
+					add(sel.Sel.Name, e.Rhs[i])
+				}
+			}
+		}
+		return true
+	})
+}
+
+// isType checks if t is the named type or a pointer to it, instances of
+// generic types are compared by their generic type.
+func isType(t types.Type, named *types.Named) bool {
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	n, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	return n.Origin().Obj() == named.Obj()
+}
+
+func hasAnyPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, value string) bool {
+	for _, entry := range list {
+		if entry == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package code
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/caos/documentation/pkg/diagnostics"
+	"github.com/caos/documentation/pkg/modules"
+	"github.com/caos/documentation/pkg/modules/pack"
+	"github.com/caos/documentation/pkg/treeelement"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// cacheFormat has to be increased whenever the elements or the way they are
+// built change, so that entries of older versions are not used
+const cacheFormat = "1"
+
+const toolModule = "github.com/caos/documentation"
+
+var version = toolVersion()
+
+// diskCache persists the elements built for types between runs. Entries are
+// keyed by the type, the environment and the version of the tool and are only
+// used as long as the files of all packages they were built from are unchanged.
+type diskCache struct {
+	dir      string
+	registry *Registry
+	formats  []string
+}
+
+type diskEntry struct {
+	// hashes of the packages the element was built from by their directory
+	Deps        map[string]string
+	Element     *treeelement.TreeElement
+	Diagnostics []*diagnostics.Diagnostic
+}
+
+// newDiskCache returns nil if dir is empty, which disables the cache.
+func newDiskCache(dir string, registry *Registry, formats []string) *diskCache {
+	if dir == "" {
+		return nil
+	}
+	return &diskCache{dir: dir, registry: registry, formats: formats}
+}
+
+func (c *diskCache) path(cache *modules.Cache, p *pack.Package, cacheKey string) string {
+	h := sha256.New()
+	for _, part := range []string{cacheFormat, version, c.registry.fingerprint(), strings.Join(c.formats, ","), cache.Fingerprint(p.BasePath), p.BasePath, cacheKey} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return filepath.Join(c.dir, hex.EncodeToString(h.Sum(nil))+".json")
+}
+
+// load returns the stored element, or nil if there is no valid entry.
+func (c *diskCache) load(cache *modules.Cache, p *pack.Package, cacheKey string) *pack.CachedElement {
+	if c == nil {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(c.path(cache, p, cacheKey))
+	if err != nil {
+		return nil
+	}
+	entry := &diskEntry{}
+	if err := json.Unmarshal(data, entry); err != nil || entry.Element == nil {
+		return nil
+	}
+
+	deps := make([]string, 0, len(entry.Deps))
+	for dir, hash := range entry.Deps {
+		if cache.Module(dir).CachePackage(dir).Hash() != hash {
+			return nil
+		}
+		deps = append(deps, dir)
+	}
+	sort.Strings(deps)
+	return &pack.CachedElement{Element: entry.Element, Deps: deps, Diagnostics: entry.Diagnostics}
+}
+
+// store writes the element, failures are ignored as the element can always be built again.
+func (c *diskCache) store(cache *modules.Cache, p *pack.Package, cacheKey string, cached *pack.CachedElement) {
+	if c == nil {
+		return
+	}
+
+	entry := &diskEntry{Deps: map[string]string{}, Element: cached.Element, Diagnostics: cached.Diagnostics}
+	for _, dir := range cached.Deps {
+		entry.Deps[dir] = cache.Module(dir).CachePackage(dir).Hash()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(c.dir, os.ModePerm); err != nil {
+		return
+	}
+	// write to a temporary file first, so that concurrent runs never read partial entries
+	tmp, err := ioutil.TempFile(c.dir, "entry-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), c.path(cache, p, cacheKey)); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// toolVersion identifies the build of this module, either as the main module
+// of the binary or as a dependency of it.
+func toolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	mod := &info.Main
+	for _, dep := range info.Deps {
+		if dep.Path == toolModule {
+			mod = dep
+		}
+	}
+	if mod.Replace != nil {
+		mod = mod.Replace
+	}
+
+	parts := []string{mod.Path, mod.Version, mod.Sum}
+	if mod == &info.Main {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" || setting.Key == "vcs.modified" {
+				parts = append(parts, setting.Value)
+			}
+		}
+	}
+	return strings.Join(parts, " ")
+}
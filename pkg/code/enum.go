@@ -0,0 +1,83 @@
+package code
+
+import (
+	"github.com/caos/documentation/pkg/modules/pack"
+	"github.com/caos/documentation/pkg/object"
+	"github.com/caos/documentation/pkg/treeelement"
+	"go/ast"
+	"go/constant"
+	"go/types"
+	"strconv"
+)
+
+// getEnumForType returns the constants declared for the named scalar type
+// typeName in package p. found is false if p declares no such scalar type.
+// Types of imported packages can only be set to exported constants.
+func getEnumForType(w *walk, p *pack.Package, typeName string, exportedOnly bool) (enum []*treeelement.EnumValue, found bool, err error) {
+	loadPackage(w, p)
+	w.depend(p.BasePath)
+	if p.Types() == nil {
+		return nil, false, nil
+	}
+
+	typeObj, ok := p.Types().Scope().Lookup(typeName).(*types.TypeName)
+	if !ok {
+		return nil, false, nil
+	}
+	if _, ok := typeObj.Type().Underlying().(*types.Basic); !ok {
+		return nil, false, nil
+	}
+
+	// an enum marker of the type takes precedence over its constants
+	if decl := p.TypeDeclaration(typeName); decl != nil {
+		obj := &object.Object{Comments: typeDoc(decl)}
+		if enum := obj.GetEnum(); len(enum) > 0 {
+			return enum, true, nil
+		}
+	}
+
+	enum = make([]*treeelement.EnumValue, 0)
+	for _, decl := range p.ConstDeclarations() {
+		for _, name := range decl.Spec.Names {
+			c, ok := p.Info().Defs[name].(*types.Const)
+			if !ok || !types.Identical(c.Type(), typeObj.Type()) || exportedOnly && !c.Exported() {
+				continue
+			}
+
+			enum = append(enum, &treeelement.EnumValue{
+				Value:       constantValue(c.Val()),
+				Description: constDescription(p, decl.Decl, decl.Spec),
+			})
+		}
+	}
+	return enum, true, nil
+}
+
+func constantValue(val constant.Value) string {
+	switch val.Kind() {
+	case constant.String:
+		return constant.StringVal(val)
+	case constant.Float:
+		// floats are kept as fractions, e.g. 1/2
+		f, _ := constant.Float64Val(val)
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return val.ExactString()
+}
+
+// constDescription returns the doc of a constant, the doc of an ungrouped
+// declaration or the comment behind the constant.
+func constDescription(p *pack.Package, gd *ast.GenDecl, vs *ast.ValueSpec) string {
+	doc := vs.Doc
+	if doc == nil && len(gd.Specs) == 1 {
+		doc = gd.Doc
+	}
+	if doc == nil {
+		doc = vs.Comment
+	}
+	if doc == nil {
+		return ""
+	}
+
+	return docObject(p, doc.Pos(), doc.Text()).GetDescription()
+}
@@ -0,0 +1,69 @@
+package code
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// knownTypes are the types of the standard library and of common dependencies
+// which are documented by their representation in configurations
+var knownTypes = map[string]string{
+	"time.Duration":            "duration string, e.g. 30s",
+	"time.Time":                "timestamp string in RFC 3339, e.g. 2006-01-02T15:04:05Z",
+	"net.IP":                   "IP address string, e.g. 192.168.0.1",
+	"encoding/json.RawMessage": "arbitrary JSON value",
+	"k8s.io/apimachinery/pkg/api/resource.Quantity":   "quantity string, e.g. 500m or 1Gi",
+	"k8s.io/apimachinery/pkg/apis/meta/v1.Duration":   "duration string, e.g. 30s",
+	"k8s.io/apimachinery/pkg/apis/meta/v1.Time":       "timestamp string in RFC 3339, e.g. 2006-01-02T15:04:05Z",
+	"k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta": "Kubernetes object metadata, e.g. name, namespace, labels and annotations",
+	"k8s.io/apimachinery/pkg/util/intstr.IntOrString": "integer or string, e.g. 8080 or http",
+}
+
+// Registry maps fully qualified types, e.g. time.Duration, to the scalar
+// representation they are documented with instead of their declaration. It
+// is safe for concurrent use.
+type Registry struct {
+	mu    sync.RWMutex
+	types map[string]string
+}
+
+// NewRegistry returns a registry with the well-known types of the standard
+// library and of Kubernetes.
+func NewRegistry() *Registry {
+	r := &Registry{types: map[string]string{}}
+	for qualifiedType, representation := range knownTypes {
+		r.types[qualifiedType] = representation
+	}
+	return r
+}
+
+// Register adds a type by its import path and name, e.g.
+// k8s.io/apimachinery/pkg/api/resource.Quantity, or replaces a built-in one.
+func (r *Registry) Register(qualifiedType, representation string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.types[qualifiedType] = representation
+}
+
+// Lookup returns the representation of the type with the name in the
+// package with the import path.
+func (r *Registry) Lookup(importPath, name string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	representation, found := r.types[strings.Join([]string{importPath, name}, ".")]
+	return representation, found
+}
+
+// fingerprint identifies the registered types for persisted elements.
+func (r *Registry) fingerprint() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := make([]string, 0, len(r.types))
+	for qualifiedType, representation := range r.types {
+		entries = append(entries, qualifiedType+"="+representation)
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, "\x00")
+}
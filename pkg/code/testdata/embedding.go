@@ -0,0 +1,17 @@
+package testdata
+
+type Common struct {
+	Name string `json:"name" yaml:"name" mapstructure:"name"`
+	Kind string `json:"kind" yaml:"kind" mapstructure:"kind"`
+}
+
+type Meta struct {
+	Kind  string `json:"kind" yaml:"kind" mapstructure:"kind"`
+	Owner string `json:"owner" yaml:"owner" mapstructure:"owner"`
+}
+
+type Embedded struct {
+	Common `yaml:",inline" mapstructure:",squash"`
+	*Meta  `yaml:",inline" mapstructure:",squash"`
+	Extra  string `json:"extra" yaml:"extra" mapstructure:"extra"`
+}
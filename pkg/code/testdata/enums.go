@@ -0,0 +1,15 @@
+package testdata
+
+// Level of logs
+type Level string
+
+const (
+	// LevelDebug logs everything
+	LevelDebug Level = "debug"
+	// LevelInfo logs less
+	LevelInfo Level = "info"
+)
+
+type Enums struct {
+	Level Level `yaml:"level"`
+}
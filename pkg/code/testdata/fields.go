@@ -0,0 +1,25 @@
+package testdata
+
+import (
+	"example.com/testdata/other"
+)
+
+type Foo struct {
+	Name string `yaml:"name"`
+}
+
+// Fields uses type expressions as they can be written by hand.
+type Fields struct {
+	Pointers map[string] *Foo            `yaml:"pointers"`
+	Callback func()                      `yaml:"callback"`
+	Events   chan Foo                    `yaml:"events"`
+	Matrix   [][]Foo                     `yaml:"matrix"`
+	Items    map[string][]other.Item     `yaml:"items"`
+	Handler  func(
+		name string,
+		count int,
+	) error `yaml:"handler"`
+	Network struct {
+		Port int `yaml:"port"`
+	} `yaml:"network"`
+}
@@ -0,0 +1,15 @@
+package testdata
+
+type List[T any] struct {
+	Items []T `yaml:"items"`
+	First T   `yaml:"first"`
+}
+
+type Node struct {
+	Value string `yaml:"value"`
+}
+
+type Generics struct {
+	Nodes List[Node]   `yaml:"nodes"`
+	Names List[string] `yaml:"names"`
+}
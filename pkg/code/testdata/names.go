@@ -0,0 +1,7 @@
+package testdata
+
+type Names struct {
+	// Host and port to bind
+	Host, Port string
+	a, B       int
+}
@@ -0,0 +1,5 @@
+package other
+
+type Item struct {
+	ID string `yaml:"id"`
+}
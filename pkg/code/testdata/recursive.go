@@ -0,0 +1,14 @@
+package testdata
+
+type Tree struct {
+	Name     string  `yaml:"name"`
+	Children []*Tree `yaml:"children"`
+}
+
+type Ping struct {
+	Pong *Pong `yaml:"pong"`
+}
+
+type Pong struct {
+	Ping *Ping `yaml:"ping"`
+}
@@ -0,0 +1,330 @@
+package code
+
+import (
+	"github.com/caos/documentation/pkg/modules"
+	"github.com/caos/documentation/pkg/modules/pack"
+	"github.com/caos/documentation/pkg/object"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// fieldType is the classification of a type expression used for a field or
+// as the underlying type of a type declaration.
+type fieldType struct {
+	// name of the type, e.g. "string" or "Foo" for pkg.Foo
+	name string
+	// package qualifier as written in the source, e.g. "pkg" for pkg.Foo
+	qualifier string
+	// import path of the package declaring the type, empty for the local package
+	importPath string
+	// type constructors in front of the type, e.g. "map[string][]*"
+	prefix string
+	// the type is a pointer itself, e.g. *Foo but not []*Foo
+	pointer    bool
+	collection bool
+	mp         bool
+	mapKey     string
+	// type arguments of an instantiated generic type
+	typeArgs []*fieldType
+	// the type is a type parameter of the enclosing generic declaration
+	typeParam bool
+	// leaf types like funcs, channels or interfaces have no attributes to resolve
+	leaf bool
+	// the empty interface, which accepts any value
+	freeForm bool
+	// the package qualifier of the type could not be resolved
+	unresolved bool
+	// fields of an anonymous struct, which are expanded like the ones of declared structs
+	fields *ast.StructType
+}
+
+// typeArgument is a type bound to the package it was written in, with its
+// own type arguments already bound.
+type typeArgument struct {
+	p    *pack.Package
+	ft   *fieldType
+	args []*typeArgument
+}
+
+// typeScope maps the type parameters of a generic declaration to the type
+// arguments it is instantiated with.
+type typeScope map[string]*typeArgument
+
+var majorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// loadPackage parses and type checks the package once and reports the files
+// which could not be parsed.
+func loadPackage(w *walk, p *pack.Package) {
+	for _, err := range p.Load(newStubImporter(w.modules, p)) {
+		w.parseError(err)
+	}
+}
+
+// stubImporter provides empty packages for every import, it is only used so
+// that the type checker can resolve package qualifiers to their import paths.
+type stubImporter struct {
+	modules  *modules.Cache
+	from     *pack.Package
+	packages map[string]*types.Package
+}
+
+func newStubImporter(cache *modules.Cache, from *pack.Package) *stubImporter {
+	return &stubImporter{modules: cache, from: from, packages: map[string]*types.Package{}}
+}
+
+func (i *stubImporter) Import(importPath string) (*types.Package, error) {
+	if pkg, found := i.packages[importPath]; found {
+		return pkg, nil
+	}
+
+	pkg := types.NewPackage(importPath, i.packageName(importPath))
+	pkg.MarkComplete()
+	i.packages[importPath] = pkg
+	return pkg, nil
+}
+
+// packageName reads the name of the imported package from its package clause
+// and guesses it from the import path if the package can't be found.
+func (i *stubImporter) packageName(importPath string) string {
+	if dir := i.modules.Module(i.from.BasePath).GetPathForImport(importPath); dir != "" {
+		if name := i.modules.Module(dir).CachePackage(dir).Name(); name != "" {
+			return name
+		}
+	}
+	return guessPackageName(importPath)
+}
+
+// fileOf returns the file of the package containing pos.
+func fileOf(p *pack.Package, pos token.Pos) *ast.File {
+	for _, file := range p.Files() {
+		if file.Pos() <= pos && pos <= file.End() {
+			return file
+		}
+	}
+	return nil
+}
+
+// fileImports maps the names of the packages imported by the file to their import paths.
+func fileImports(p *pack.Package, file *ast.File) map[string]string {
+	imports := map[string]string{}
+	if file == nil || p.Info() == nil {
+		return imports
+	}
+	scope := p.Info().Scopes[file]
+	if scope == nil {
+		return imports
+	}
+	for _, name := range scope.Names() {
+		if pkgName, ok := scope.Lookup(name).(*types.PkgName); ok {
+			imports[name] = pkgName.Imported().Path()
+		}
+	}
+	return imports
+}
+
+// lookupSym reports if the package declares the symbol, recv is the type of methods and fields.
+func lookupSym(p *pack.Package) func(recv, name string) bool {
+	return func(recv, name string) bool {
+		if p.Types() == nil {
+			return false
+		}
+		if recv == "" {
+			return p.Types().Scope().Lookup(name) != nil
+		}
+		typeName, ok := p.Types().Scope().Lookup(recv).(*types.TypeName)
+		if !ok {
+			return false
+		}
+		obj, _, _ := types.LookupFieldOrMethod(typeName.Type(), true, p.Types(), name)
+		return obj != nil
+	}
+}
+
+// docObject returns an object for the doc comment written at pos, so that its
+// doc links are resolved with the imports of the file.
+func docObject(p *pack.Package, pos token.Pos, doc string) *object.Object {
+	return &object.Object{Comments: doc, ImportPath: p.ImportPath, Imports: fileImports(p, fileOf(p, pos)), LookupSym: lookupSym(p)}
+}
+
+func guessPackageName(importPath string) string {
+	name := path.Base(importPath)
+	if majorVersion.MatchString(name) && path.Dir(importPath) != "." {
+		name = path.Base(path.Dir(importPath))
+	}
+	if idx := strings.Index(name, ".v"); idx > 0 {
+		name = name[:idx]
+	}
+	name = strings.TrimPrefix(name, "go-")
+	name = strings.TrimSuffix(name, "-go")
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+func resolveFieldType(info *types.Info, expr ast.Expr) *fieldType {
+	ft := &fieldType{}
+	for {
+		switch e := expr.(type) {
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.StarExpr:
+			if ft.prefix == "" {
+				ft.pointer = true
+			}
+			ft.prefix += "*"
+			expr = e.X
+		case *ast.ArrayType:
+			ft.collection = true
+			if e.Len == nil {
+				ft.prefix += "[]"
+			} else {
+				ft.prefix += "[" + types.ExprString(e.Len) + "]"
+			}
+			expr = e.Elt
+		case *ast.MapType:
+			if !ft.mp {
+				ft.mp = true
+				ft.mapKey = types.ExprString(e.Key)
+			}
+			ft.prefix += "map[" + types.ExprString(e.Key) + "]"
+			expr = e.Value
+		case *ast.IndexExpr:
+			ft.typeArgs = append(ft.typeArgs, resolveFieldType(info, e.Index))
+			expr = e.X
+		case *ast.IndexListExpr:
+			for _, index := range e.Indices {
+				ft.typeArgs = append(ft.typeArgs, resolveFieldType(info, index))
+			}
+			expr = e.X
+		case *ast.Ident:
+			ft.name = e.Name
+			typeName, ok := info.Uses[e].(*types.TypeName)
+			if ok {
+				_, ft.typeParam = typeName.Type().(*types.TypeParam)
+			}
+			if e.Name == "any" && (!ok || typeName.Pkg() == nil) {
+				ft.leaf = true
+				ft.freeForm = true
+			}
+			return ft
+		case *ast.StructType:
+			ft.name = types.ExprString(expr)
+			ft.fields = e
+			return ft
+		case *ast.InterfaceType:
+			ft.name = types.ExprString(expr)
+			ft.leaf = true
+			ft.freeForm = e.Methods == nil || len(e.Methods.List) == 0
+			return ft
+		case *ast.SelectorExpr:
+			ft.name = e.Sel.Name
+			x, ok := e.X.(*ast.Ident)
+			if !ok {
+				ft.unresolved = true
+				return ft
+			}
+			ft.qualifier = x.Name
+			pkgName, ok := info.Uses[x].(*types.PkgName)
+			if !ok {
+				ft.unresolved = true
+				return ft
+			}
+			ft.importPath = pkgName.Imported().Path()
+			return ft
+		default:
+			// funcs and channels
+			ft.name = types.ExprString(expr)
+			ft.leaf = true
+			return ft
+		}
+	}
+}
+
+// freeFormRepresentation documents fields of the empty interface, which
+// accept any value, or any object if used as the values of a map.
+func (ft *fieldType) freeFormRepresentation() string {
+	if ft.mp {
+		return "arbitrary object"
+	}
+	return "arbitrary value"
+}
+
+// substitute returns the type argument arg wrapped in the type constructors
+// used around the type parameter ft, e.g. []T with T=*Foo results in []*Foo.
+func (ft *fieldType) substitute(arg *fieldType) *fieldType {
+	sub := *arg
+	sub.prefix = ft.prefix + arg.prefix
+	sub.pointer = ft.pointer || ft.prefix == "" && arg.pointer
+	sub.collection = ft.collection || arg.collection
+	if ft.mp {
+		sub.mp = true
+		sub.mapKey = ft.mapKey
+	}
+	return &sub
+}
+
+// bind resolves the type parameters used in ft with the type arguments of the scope.
+func (s typeScope) bind(p *pack.Package, ft *fieldType) *typeArgument {
+	if ft.typeParam {
+		if arg, found := s[ft.name]; found && arg != nil {
+			return &typeArgument{p: arg.p, ft: ft.substitute(arg.ft), args: arg.args}
+		}
+	}
+
+	args := make([]*typeArgument, 0, len(ft.typeArgs))
+	for _, typeArg := range ft.typeArgs {
+		args = append(args, s.bind(p, typeArg))
+	}
+	return &typeArgument{p: p, ft: ft, args: args}
+}
+
+// display returns the type argument as written in the source, with type
+// parameters replaced by their arguments.
+func (a *typeArgument) display() string {
+	name := a.ft.name
+	if a.ft.qualifier != "" {
+		name = strings.Join([]string{a.ft.qualifier, name}, ".")
+	}
+	return a.ft.prefix + instanceName(name, a.args)
+}
+
+// key identifies the type argument independent of the package it was written in.
+func (a *typeArgument) key() string {
+	pkg := a.ft.importPath
+	if pkg == "" && !a.ft.leaf {
+		pkg = a.p.BasePath
+	}
+	return a.ft.prefix + instanceKey(strings.Join([]string{pkg, a.ft.name}, "."), a.args)
+}
+
+// instanceName returns the name of a generic type instantiated with args, e.g. List[Node].
+func instanceName(name string, args []*typeArgument) string {
+	if len(args) == 0 {
+		return name
+	}
+
+	argNames := make([]string, 0, len(args))
+	for _, arg := range args {
+		argNames = append(argNames, arg.display())
+	}
+	return name + "[" + strings.Join(argNames, ", ") + "]"
+}
+
+func instanceKey(name string, args []*typeArgument) string {
+	if len(args) == 0 {
+		return name
+	}
+
+	argKeys := make([]string, 0, len(args))
+	for _, arg := range args {
+		argKeys = append(argKeys, arg.key())
+	}
+	return name + "[" + strings.Join(argKeys, ", ") + "]"
+}
@@ -0,0 +1,210 @@
+package code
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/caos/documentation/pkg/diagnostics"
+	"github.com/caos/documentation/pkg/modules"
+	"github.com/caos/documentation/pkg/modules/pack"
+	"go/scanner"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+const defaultFormat = "yaml"
+
+// walk holds the state of a single traversal from a root struct down to the
+// field which is currently resolved.
+type walk struct {
+	modules     *modules.Cache
+	registry    *Registry
+	formats     []string
+	disk        *diskCache
+	diagnostics *diagnostics.Diagnostics
+	// fingerprint of the registry and the formats the elements are built with
+	variant string
+	// diagnostics reported by the traversal
+	reports []*diagnostics.Diagnostic
+	// number of parse errors reported by the traversal
+	parseErrors int
+	// attribute names from the root struct to the current field
+	path []string
+	// types which are currently expanded mapped to their depth in the traversal
+	expanding map[string]int
+	// lowest depth of an expanding type which was referenced recursively
+	lowestReference int
+	// directories of the packages used by the elements which are currently built
+	deps []map[string]bool
+}
+
+func newWalk(opts Options, diags *diagnostics.Diagnostics) *walk {
+	registry := opts.Registry
+	if registry == nil {
+		registry = NewRegistry()
+	}
+	formats := opts.Formats
+	if len(formats) == 0 {
+		formats = []string{defaultFormat}
+	}
+	return &walk{
+		modules:     opts.Modules,
+		registry:    registry,
+		formats:     formats,
+		disk:        newDiskCache(opts.CacheDir, registry, formats),
+		diagnostics: diags,
+		variant:     variant(registry, formats),
+		path:        make([]string, 0),
+		expanding:   map[string]int{},
+	}
+}
+
+// variant identifies the registry and the formats, elements built with
+// others are different and must not be shared through the package caches.
+func variant(registry *Registry, formats []string) string {
+	h := sha256.New()
+	for _, part := range []string{registry.fingerprint(), strings.Join(formats, ",")} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// elementKey returns the key of the element for the type in the package caches.
+func (w *walk) elementKey(cacheKey string) string {
+	return strings.Join([]string{w.variant, cacheKey}, ":")
+}
+
+func (w *walk) push(attribute string) {
+	w.path = append(w.path, attribute)
+}
+
+func (w *walk) pop() {
+	w.path = w.path[:len(w.path)-1]
+}
+
+func (w *walk) warnf(pos token.Position, format string, args ...interface{}) {
+	w.report(diagnostics.Warning, pos, w.attributePath(), fmt.Sprintf(format, args...))
+}
+
+func (w *walk) errorf(pos token.Position, format string, args ...interface{}) {
+	w.report(diagnostics.Error, pos, w.attributePath(), fmt.Sprintf(format, args...))
+}
+
+func (w *walk) report(severity diagnostics.Severity, pos token.Position, path, msg string) {
+	w.reports = append(w.reports, &diagnostics.Diagnostic{Severity: severity, Position: pos, Path: path, Message: msg})
+	w.diagnostics.Add(severity, pos, path, "%s", msg)
+}
+
+func (w *walk) attributePath() string {
+	return strings.Join(w.path, ".")
+}
+
+// relativeReports returns the diagnostics reported since start with their
+// paths relative to the attribute path prefix.
+func (w *walk) relativeReports(start int, prefix string) []*diagnostics.Diagnostic {
+	reports := make([]*diagnostics.Diagnostic, 0, len(w.reports)-start)
+	for _, report := range w.reports[start:] {
+		relative := *report
+		relative.Path = strings.TrimPrefix(strings.TrimPrefix(report.Path, prefix), ".")
+		reports = append(reports, &relative)
+	}
+	return reports
+}
+
+// replay reports the diagnostics of a cached element at the current attribute path.
+func (w *walk) replay(reports []*diagnostics.Diagnostic) {
+	prefix := w.attributePath()
+	for _, report := range reports {
+		path := report.Path
+		if prefix != "" {
+			path = strings.TrimSuffix(strings.Join([]string{prefix, path}, "."), ".")
+		}
+		w.report(report.Severity, report.Position, path, report.Message)
+	}
+}
+
+// parseError adds a diagnostic for every error the parser reported for a file.
+func (w *walk) parseError(err error) {
+	w.parseErrors++
+	if list, ok := err.(scanner.ErrorList); ok {
+		for _, parseErr := range list {
+			w.diagnostics.Errorf(parseErr.Pos, "", "%s", parseErr.Msg)
+		}
+		return
+	}
+	w.diagnostics.Errorf(token.Position{}, "", "%s", err.Error())
+}
+
+func expansionKey(p *pack.Package, cacheKey string) string {
+	return strings.Join([]string{p.BasePath, cacheKey}, ":")
+}
+
+// isExpanding checks if the type is expanded further up in the traversal and
+// remembers the reference if so.
+func (w *walk) isExpanding(p *pack.Package, cacheKey string) bool {
+	depth, found := w.expanding[expansionKey(p, cacheKey)]
+	if found && depth < w.lowestReference {
+		w.lowestReference = depth
+	}
+	return found
+}
+
+// enter marks the type as expanding. The returned function has to be called
+// after the expansion and returns if the built element is independent of the
+// types further up and can be cached.
+func (w *walk) enter(p *pack.Package, cacheKey string) func() bool {
+	key := expansionKey(p, cacheKey)
+	depth := len(w.expanding)
+	w.expanding[key] = depth
+
+	outerLowest := w.lowestReference
+	w.lowestReference = depth
+
+	return func() bool {
+		delete(w.expanding, key)
+		cacheable := w.lowestReference >= depth
+		if w.lowestReference < outerLowest {
+			outerLowest = w.lowestReference
+		}
+		w.lowestReference = outerLowest
+		return cacheable
+	}
+}
+
+// trackDeps starts collecting the packages an element is built from.
+func (w *walk) trackDeps() {
+	w.deps = append(w.deps, map[string]bool{})
+}
+
+// depend records that the elements which are currently built use the packages in dirs.
+func (w *walk) depend(dirs ...string) {
+	if len(w.deps) == 0 {
+		return
+	}
+	for _, dir := range dirs {
+		w.deps[len(w.deps)-1][dir] = true
+	}
+}
+
+// untrackDeps returns the packages used since the matching trackDeps, they
+// are used by the enclosing element as well.
+func (w *walk) untrackDeps() []string {
+	last := w.deps[len(w.deps)-1]
+	w.deps = w.deps[:len(w.deps)-1]
+
+	dirs := make([]string, 0, len(last))
+	for dir := range last {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	w.depend(dirs...)
+	return dirs
+}
+
+// useCached records the packages and reports the diagnostics of a cached element.
+func (w *walk) useCached(cached *pack.CachedElement) {
+	w.depend(cached.Deps...)
+	w.replay(cached.Diagnostics)
+}
@@ -0,0 +1,118 @@
+package diagnostics
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+	"sync"
+)
+
+type Severity int
+
+const (
+	Warning Severity = iota
+	Error
+)
+
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+// Diagnostic is a problem found while documenting, positioned in the source
+// and in the attribute tree.
+type Diagnostic struct {
+	Severity Severity
+	Position token.Position
+	// attribute path from the root struct, e.g. spec.network.foo
+	Path    string
+	Message string
+}
+
+func (d *Diagnostic) String() string {
+	parts := make([]string, 0)
+	if d.Position.IsValid() {
+		parts = append(parts, d.Position.String())
+	}
+	parts = append(parts, d.Severity.String())
+
+	msg := d.Message
+	if d.Path != "" {
+		msg = strings.Join([]string{msg, "at", d.Path}, " ")
+	}
+	parts = append(parts, msg)
+	return strings.Join(parts, ": ")
+}
+
+// Diagnostics collects the diagnostics of one or more traversals, it is safe
+// for concurrent use.
+type Diagnostics struct {
+	mu   sync.Mutex
+	list []*Diagnostic
+}
+
+func New() *Diagnostics {
+	return &Diagnostics{list: make([]*Diagnostic, 0)}
+}
+
+// Add adds a diagnostic, diagnostics which were already added are ignored.
+// Positioned diagnostics are only added for the first attribute path, as
+// types used several times would otherwise repeat them for every use.
+func (d *Diagnostics) Add(severity Severity, position token.Position, path string, format string, args ...interface{}) {
+	diag := &Diagnostic{
+		Severity: severity,
+		Position: position,
+		Path:     path,
+		Message:  fmt.Sprintf(format, args...),
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, existing := range d.list {
+		if *existing == *diag {
+			return
+		}
+		if diag.Position.IsValid() && existing.Position == diag.Position && existing.Severity == diag.Severity && existing.Message == diag.Message {
+			return
+		}
+	}
+	d.list = append(d.list, diag)
+}
+
+func (d *Diagnostics) Warnf(position token.Position, path string, format string, args ...interface{}) {
+	d.Add(Warning, position, path, format, args...)
+}
+
+func (d *Diagnostics) Errorf(position token.Position, path string, format string, args ...interface{}) {
+	d.Add(Error, position, path, format, args...)
+}
+
+func (d *Diagnostics) List() []*Diagnostic {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*Diagnostic{}, d.list...)
+}
+
+func (d *Diagnostics) Count(severity Severity) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	count := 0
+	for _, diag := range d.list {
+		if diag.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
+
+// Err returns an error if there are errors, or warnings if failOnWarnings is set.
+func (d *Diagnostics) Err(failOnWarnings bool) error {
+	errs := d.Count(Error)
+	warnings := d.Count(Warning)
+	if errs == 0 && (!failOnWarnings || warnings == 0) {
+		return nil
+	}
+	return fmt.Errorf("documentation failed with %d errors and %d warnings", errs, warnings)
+}
@@ -2,45 +2,221 @@ package docu
 
 import (
 	"github.com/caos/documentation/pkg/code"
+	"github.com/caos/documentation/pkg/diagnostics"
+	"github.com/caos/documentation/pkg/modules"
 	"github.com/caos/documentation/pkg/treeelement"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sync"
 )
 
+type page struct {
+	element *treeelement.TreeElement
+	path    string
+}
+
+// Documentation is safe for concurrent use, the tree and the diagnostics are
+// the ones of the last finished call of Parse or ParseStructs.
 type Documentation struct {
-	tree       []*treeelement.TreeElement
-	modulePath string
+	mu             sync.Mutex
+	cache          *modules.Cache
+	registry       *code.Registry
+	formats        []string
+	cacheDir       string
+	tree           []*treeelement.TreeElement
+	modulePath     string
+	diagnostics    *diagnostics.Diagnostics
+	failOnWarnings bool
+	workers        int
 }
 
 func New() *Documentation {
 	elements := make([]*treeelement.TreeElement, 0)
 
-	return &Documentation{tree: elements}
+	return &Documentation{
+		cache:       modules.NewCache(),
+		registry:    code.NewRegistry(),
+		tree:        elements,
+		diagnostics: diagnostics.New(),
+		workers:     runtime.GOMAXPROCS(0),
+	}
+}
+
+// Cache returns the cache of modules, packages and elements the documentation reads from.
+func (d *Documentation) Cache() *modules.Cache {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cache
+}
+
+// ShareCache makes the documentation use the cache of another one, so that
+// packages are only parsed once. The options of the cache, e.g. the build
+// constraints, are shared as well.
+func (d *Documentation) ShareCache(cache *modules.Cache) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cache = cache
+}
+
+// Reset drops the cached modules, packages and elements, so that the next
+// call of Parse reads the sources again.
+func (d *Documentation) Reset() {
+	d.Cache().Reset()
+}
+
+// RegisterType documents the type by its representation instead of its
+// declaration, e.g. time.Duration as "duration string, e.g. 30s". The type is
+// given by its import path and name.
+func (d *Documentation) RegisterType(qualifiedType, representation string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.registry.Register(qualifiedType, representation)
+}
+
+// SetFormats sets the tag keys attribute names are read from, e.g. json for
+// JSON APIs. Fields use the first key they have a tag for, so yaml and json
+// documents types which only carry json tags as well.
+func (d *Documentation) SetFormats(formats ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.formats = formats
+}
+
+// SetCacheDir sets a directory in which the documented types are kept
+// between runs, types are only parsed again if the sources they are built
+// from changed. An empty dir disables it, which is the default.
+func (d *Documentation) SetCacheDir(dir string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cacheDir = dir
+}
+
+// SetVerbose enables printing which sources are used for imported packages.
+func (d *Documentation) SetVerbose(verbose bool) {
+	d.Cache().SetVerbose(verbose)
+}
+
+// SetBuildConstraints sets the target and the build tags which decide which
+// files of a package are documented.
+func (d *Documentation) SetBuildConstraints(goos, goarch string, tags []string) {
+	d.Cache().SetBuildConstraints(goos, goarch, tags)
+}
+
+// SetFailOnWarnings makes Parse fail if warnings were found, by default only errors fail.
+func (d *Documentation) SetFailOnWarnings(failOnWarnings bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.failOnWarnings = failOnWarnings
+}
+
+// SetWorkers sets the maximum number of structs documented and files parsed
+// in parallel, values below 1 use the number of CPUs.
+func (d *Documentation) SetWorkers(workers int) {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.workers = workers
+	d.cache.SetParseWorkers(workers)
+}
+
+// Diagnostics returns the errors and warnings found by the last call of Parse.
+func (d *Documentation) Diagnostics() []*diagnostics.Diagnostic {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.diagnostics.List()
+}
+
+// PackageDescription returns the package doc of the package in path, e.g. for
+// an overview page of the documented types. It is doc comment text with
+// qualified doc links, see object.QualifyDocLinks.
+func (d *Documentation) PackageDescription(path string) string {
+	d.mu.Lock()
+	opts := code.Options{Modules: d.cache, Registry: d.registry, Formats: d.formats, CacheDir: d.cacheDir}
+	d.mu.Unlock()
+
+	return code.GetPackageDescription(opts, path, diagnostics.New())
 }
+
 func (d *Documentation) Parse(path string, structName string) error {
-	elements := make([]*treeelement.TreeElement, 0)
+	return d.ParseStructs(path, structName)
+}
 
-	element, err := code.GetElementForStruct(path, structName)
-	if err != nil {
-		return err
+// ParseStructs documents several structs of the package in path in parallel,
+// each one gets its own page tree.
+func (d *Documentation) ParseStructs(path string, structNames ...string) error {
+	d.mu.Lock()
+	opts := code.Options{Modules: d.cache, Registry: d.registry, Formats: d.formats, CacheDir: d.cacheDir}
+	workers, failOnWarnings := d.workers, d.failOnWarnings
+	d.mu.Unlock()
+
+	diags := diagnostics.New()
+	elements := make([]*treeelement.TreeElement, len(structNames))
+	errs := make([]error, len(structNames))
+
+	sem := make(chan struct{}, workers)
+	wg := sync.WaitGroup{}
+	for i := range structNames {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			elements[i], errs[i] = code.GetElementForStruct(opts, path, structNames[i], diags)
+			<-sem
+		}(i)
 	}
-	elements = append(elements, element)
+	wg.Wait()
 
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.diagnostics = diags
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
 	d.tree = elements
-	return nil
+	return diags.Err(failOnWarnings)
 }
 
 func (d *Documentation) GenerateMarkDown(basePath string, replace map[string]string) error {
-	for _, element := range d.tree {
-		if err := generateMarkDownPerElement(basePath, element, replace); err != nil {
+	d.mu.Lock()
+	tree := d.tree
+	d.mu.Unlock()
+
+	pages := treeelement.Pages{}
+	for _, element := range tree {
+		addPages(pages, basePath, element, replace)
+	}
+	for _, element := range tree {
+		if err := generateMarkDownPerElement(basePath, element, replace, pages, nil); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func generateMarkDownPerElement(basePath string, element *treeelement.TreeElement, replace map[string]string) error {
+// addPages adds the pages generateMarkDownPerElement writes for the element,
+// so that doc links can link to them.
+func addPages(pages treeelement.Pages, basePath string, element *treeelement.TreeElement, replace map[string]string) {
+	if element == nil {
+		return
+	}
+
+	pages.Add(element, element.GetMDFilePath(basePath))
+	for _, subelement := range element.SubElements {
+		if subelement != nil && !subelement.Recursive && len(subelement.SubElements) > 0 {
+			if !subelement.IsReplaced(replace) {
+				addPages(pages, filepath.Join(basePath, subelement.GoPackage, subelement.GetPageName()), subelement, nil)
+			}
+		}
+	}
+}
+
+func generateMarkDownPerElement(basePath string, element *treeelement.TreeElement, replace map[string]string, pages treeelement.Pages, ancestors []*page) error {
 	if element == nil {
 		return nil
 	}
@@ -49,15 +225,23 @@ func generateMarkDownPerElement(basePath string, element *treeelement.TreeElemen
 		return err
 	}
 
-	data, filePath := element.GetMDFile(basePath, replace)
+	ancestors = append(ancestors, &page{element: element, path: element.GetMDFilePath(basePath)})
+	links := map[*treeelement.TreeElement]string{}
+	for _, subelement := range element.SubElements {
+		if subelement != nil && subelement.Recursive {
+			links[subelement] = getRecursionLink(basePath, subelement, ancestors)
+		}
+	}
+
+	data, filePath := element.Render(basePath, treeelement.RenderOptions{Replace: replace, Pages: pages, RecursionLinks: links})
 	if err := ioutil.WriteFile(filePath, data, os.ModePerm); err != nil {
 		return err
 	}
 
 	if element.SubElements != nil {
 		for _, subelement := range element.SubElements {
-			if subelement != nil && !subelement.Replaced && subelement.SubElements != nil && len(subelement.SubElements) > 0 {
-				if err := generateMarkDownPerElement(filepath.Join(basePath, subelement.GoPackage, subelement.GoType), subelement, nil); err != nil {
+			if subelement != nil && !subelement.IsReplaced(replace) && !subelement.Recursive && subelement.SubElements != nil && len(subelement.SubElements) > 0 {
+				if err := generateMarkDownPerElement(filepath.Join(basePath, subelement.GoPackage, subelement.GetPageName()), subelement, nil, pages, ancestors); err != nil {
 					return err
 				}
 			}
@@ -65,3 +249,21 @@ func generateMarkDownPerElement(basePath string, element *treeelement.TreeElemen
 	}
 	return nil
 }
+
+// getRecursionLink returns the relative link to the page of the nearest
+// ancestor with the type of the recursive element.
+func getRecursionLink(basePath string, element *treeelement.TreeElement, ancestors []*page) string {
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		ancestor := ancestors[i].element
+		if ancestor.GoType != element.GoType || ancestor.GoPackagePath != element.GoPackagePath {
+			continue
+		}
+
+		link, err := filepath.Rel(basePath, ancestors[i].path)
+		if err != nil {
+			return ""
+		}
+		return filepath.ToSlash(link)
+	}
+	return ""
+}
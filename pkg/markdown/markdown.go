@@ -8,6 +8,8 @@ const (
 	tableLineSuffix = " |"
 	header1         = "#"
 	header2         = "##"
+	header3         = "###"
+	codeFence       = "```"
 	space           = " "
 	newLine         = "\n"
 )
@@ -76,6 +78,15 @@ func (m *Markdown) AddHeader2(text string) {
 	m.lines = append(m.lines, strings.Join([]string{header2, text, newLine, newLine}, space))
 }
 
+func (m *Markdown) AddHeader3(text string) {
+	m.lines = append(m.lines, strings.Join([]string{header3, text, newLine, newLine}, space))
+}
+
+// AddCodeBlock adds a fenced block of code, language can be empty.
+func (m *Markdown) AddCodeBlock(language, code string) {
+	m.lines = append(m.lines, codeFence+language, code, codeFence, "")
+}
+
 func getHeader(title string, length int) (string, string) {
 	columnSlice := make([]string, 0)
 	for i := 0; i < length; i++ {
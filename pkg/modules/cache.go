@@ -0,0 +1,167 @@
+package modules
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/caos/documentation/pkg/modules/pack"
+	"io/ioutil"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Cache holds the loaded modules together with their packages and the
+// elements built for them, it is safe for concurrent use.
+type Cache struct {
+	mu      sync.Mutex
+	modules []*Module
+	// roots maps the paths modules were looked up for to their modules, so
+	// that the module root is only searched once per path
+	roots map[string]*Module
+	// mainModule is the first loaded module, its requirements and vendor
+	// directory take precedence when resolving imports of its dependencies
+	mainModule *Module
+	options    pack.Options
+	// fingerprints of the modules by their root directory
+	fingerprints map[string]string
+	// logger prints how imports are resolved when verbose output is enabled
+	logger *log.Logger
+}
+
+func NewCache() *Cache {
+	return &Cache{
+		modules:      make([]*Module, 0),
+		roots:        map[string]*Module{},
+		options:      pack.DefaultOptions(),
+		fingerprints: map[string]string{},
+		logger:       log.New(ioutil.Discard, "", 0),
+	}
+}
+
+// SetVerbose enables printing which source directory is chosen for imports.
+func (c *Cache) SetVerbose(verbose bool) {
+	if verbose {
+		c.logger.SetOutput(os.Stderr)
+	} else {
+		c.logger.SetOutput(ioutil.Discard)
+	}
+}
+
+// SetBuildConstraints sets the target and build tags used to select the
+// files of packages, empty values keep the defaults of the environment.
+// Packages loaded with other constraints are dropped.
+func (c *Cache) SetBuildConstraints(goos, goarch string, tags []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.options.SetBuildConstraints(goos, goarch, tags)
+	c.reset()
+}
+
+// SetParseWorkers sets the maximum number of files parsed in parallel for a
+// package, values below 1 use the number of CPUs.
+func (c *Cache) SetParseWorkers(workers int) {
+	if workers < 1 {
+		workers = pack.DefaultOptions().ParseWorkers
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.options.ParseWorkers = workers
+}
+
+// Reset drops all loaded modules, so that sources are read again.
+func (c *Cache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reset()
+}
+
+func (c *Cache) reset() {
+	c.modules = make([]*Module, 0)
+	c.roots = map[string]*Module{}
+	c.mainModule = nil
+	c.fingerprints = map[string]string{}
+}
+
+// Module returns the module containing path and loads it if necessary.
+func (c *Cache) Module(path string) *Module {
+	c.mu.Lock()
+	module, found := c.roots[path]
+	c.mu.Unlock()
+	if found {
+		return module
+	}
+
+	// the search reads the file system, so it is done without holding the lock
+	basePath, mf := findModuleRoot(path)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, module := range c.modules {
+		if module.basePath == basePath {
+			c.roots[path] = module
+			return module
+		}
+	}
+
+	module = New(basePath, mf.module)
+	module.cache = c
+	module.load(mf)
+	if c.mainModule == nil {
+		c.mainModule = module
+	}
+	c.modules = append(c.modules, module)
+	c.roots[path] = module
+	return module
+}
+
+func (c *Cache) main() *Module {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.mainModule
+}
+
+func (c *Cache) packageOptions() pack.Options {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.options
+}
+
+// Fingerprint returns a hash of everything besides the sources of packages
+// which decides how the package in path is documented: the build
+// constraints and the files of its module and of the main module which
+// decide how imports are resolved. It is computed once per module.
+func (c *Cache) Fingerprint(path string) string {
+	module := c.Module(path)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if fingerprint, found := c.fingerprints[module.basePath]; found {
+		return fingerprint
+	}
+	main := c.mainModule
+	options := c.options
+
+	h := sha256.New()
+	ctx := options.BuildContext
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00", ctx.GOOS, ctx.GOARCH, strings.Join(ctx.BuildTags, ","), runtime.Version())
+	for _, m := range []*Module{main, module} {
+		if m == nil {
+			continue
+		}
+		fmt.Fprintf(h, "%s\x00", m.basePath)
+		for _, file := range m.moduleFiles() {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(h, "%s\x00", file)
+			h.Write(data)
+			h.Write([]byte{0})
+		}
+	}
+	fingerprint := hex.EncodeToString(h.Sum(nil))
+	c.fingerprints[module.basePath] = fingerprint
+	return fingerprint
+}
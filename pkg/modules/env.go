@@ -0,0 +1,66 @@
+package modules
+
+import (
+	"go/build"
+	"golang.org/x/mod/module"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func goRoot() string {
+	return build.Default.GOROOT
+}
+
+func goPaths() []string {
+	return filepath.SplitList(build.Default.GOPATH)
+}
+
+func modCacheDir() string {
+	if cache := os.Getenv("GOMODCACHE"); cache != "" {
+		return cache
+	}
+	paths := goPaths()
+	if len(paths) == 0 {
+		return ""
+	}
+	return filepath.Join(paths[0], "pkg", "mod")
+}
+
+// modFlag returns the value of -mod in $GOFLAGS.
+func modFlag() string {
+	for _, flag := range strings.Fields(os.Getenv("GOFLAGS")) {
+		if strings.HasPrefix(flag, "-mod=") {
+			return strings.TrimPrefix(flag, "-mod=")
+		}
+	}
+	return ""
+}
+
+func modCachePath(mod, version string) string {
+	cache := modCacheDir()
+	if cache == "" {
+		return ""
+	}
+	escapedMod, err := module.EscapePath(mod)
+	if err != nil {
+		return ""
+	}
+	escapedVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(cache, filepath.FromSlash(escapedMod+"@"+escapedVersion))
+}
+
+// hasPathPrefix checks if path is equal to prefix or a sub path of it.
+func hasPathPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// isStandardImport checks if the import is a package of the standard
+// library, their paths have no dot in the first element and they are in GOROOT.
+func isStandardImport(importPath string) bool {
+	first := strings.SplitN(importPath, "/", 2)[0]
+	return !strings.Contains(first, ".") && dirExists(filepath.Join(goRoot(), "src", filepath.FromSlash(importPath)))
+}
@@ -0,0 +1,65 @@
+package modules
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestModCachePath(t *testing.T) {
+	t.Setenv("GOMODCACHE", "/cache")
+	tests := []struct {
+		mod, version string
+		want         string
+	}{
+		{mod: "example.com/a", version: "v1.0.0", want: "/cache/example.com/a@v1.0.0"},
+		{mod: "github.com/BurntSushi/toml", version: "v1.2.0-RC", want: "/cache/github.com/!burnt!sushi/toml@v1.2.0-!r!c"},
+		{mod: "example.com/a", version: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mod+"@"+tt.version, func(t *testing.T) {
+			if got := modCachePath(tt.mod, tt.version); got != filepath.FromSlash(tt.want) {
+				t.Errorf("modCachePath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasPathPrefix(t *testing.T) {
+	tests := []struct {
+		path, prefix string
+		want         bool
+	}{
+		{path: "example.com/a", prefix: "example.com/a", want: true},
+		{path: "example.com/a/b", prefix: "example.com/a", want: true},
+		{path: "example.com/ab", prefix: "example.com/a", want: false},
+		{path: "example.com", prefix: "example.com/a", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.prefix, func(t *testing.T) {
+			if got := hasPathPrefix(tt.path, tt.prefix); got != tt.want {
+				t.Errorf("hasPathPrefix() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsStandardImport(t *testing.T) {
+	tests := []struct {
+		importPath string
+		want       bool
+	}{
+		{importPath: "fmt", want: true},
+		{importPath: "net/http", want: true},
+		{importPath: "example.com/a", want: false},
+		// module paths without a dot which are no packages of GOROOT, e.g. replaced ones
+		{importPath: "mylib", want: false},
+		{importPath: "net/notapackage", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.importPath, func(t *testing.T) {
+			if got := isStandardImport(tt.importPath); got != tt.want {
+				t.Errorf("isStandardImport() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
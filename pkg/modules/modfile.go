@@ -0,0 +1,188 @@
+package modules
+
+import (
+	"bufio"
+	"golang.org/x/mod/modfile"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	goModFile      = "go.mod"
+	goSumFile      = "go.sum"
+	goWorkFile     = "go.work"
+	vendorDir      = "vendor"
+	vendorModsFile = "modules.txt"
+)
+
+// modFile contains the directives of a go.mod or go.work file which are
+// needed to resolve imports.
+type modFile struct {
+	module    string
+	goVersion string
+	requires  map[string]string
+	replaces  []*replace
+	uses      []string
+}
+
+// replace is a replace directive, newVersion is empty if the replacement is a
+// local directory.
+type replace struct {
+	oldPath    string
+	oldVersion string
+	newPath    string
+	newVersion string
+}
+
+// parseModFile parses go.mod and go.work files. go.mod files with directives
+// which are unknown to golang.org/x/mod are parsed like the ones of
+// dependencies, which drops their replace directives.
+func parseModFile(path string) (*modFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	mf := &modFile{
+		requires: map[string]string{},
+		replaces: make([]*replace, 0),
+		uses:     make([]string, 0),
+	}
+	if filepath.Base(path) == goWorkFile {
+		wf, err := modfile.ParseWork(path, data, nil)
+		if err != nil {
+			return nil, err
+		}
+		if wf.Go != nil {
+			mf.goVersion = wf.Go.Version
+		}
+		for _, use := range wf.Use {
+			mf.uses = append(mf.uses, use.Path)
+		}
+		mf.addReplaces(wf.Replace)
+		return mf, nil
+	}
+
+	f, err := modfile.Parse(path, data, nil)
+	if err != nil {
+		if f, err = modfile.ParseLax(path, data, nil); err != nil {
+			return nil, err
+		}
+	}
+	if f.Module != nil {
+		mf.module = f.Module.Mod.Path
+	}
+	if f.Go != nil {
+		mf.goVersion = f.Go.Version
+	}
+	for _, require := range f.Require {
+		mf.requires[require.Mod.Path] = require.Mod.Version
+	}
+	mf.addReplaces(f.Replace)
+	return mf, nil
+}
+
+func (mf *modFile) addReplaces(replaces []*modfile.Replace) {
+	for _, r := range replaces {
+		mf.replaces = append(mf.replaces, &replace{
+			oldPath:    r.Old.Path,
+			oldVersion: r.Old.Version,
+			newPath:    r.New.Path,
+			newVersion: r.New.Version,
+		})
+	}
+}
+
+// isLocal checks if the replacement is a directory instead of a module version.
+func (r *replace) isLocal() bool {
+	return r.newVersion == ""
+}
+
+// parseGoSum returns all versions listed in a go.sum file per module path.
+func parseGoSum(path string) (map[string][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	sums := map[string][]string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		version := strings.TrimSuffix(fields[1], "/"+goModFile)
+		if !containsString(sums[fields[0]], version) {
+			sums[fields[0]] = append(sums[fields[0]], version)
+		}
+	}
+	return sums, scanner.Err()
+}
+
+// parseVendorModules returns the modules listed in vendor/modules.txt.
+func parseVendorModules(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	mods := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "# ") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "# "))
+		if len(fields) > 0 {
+			mods = append(mods, fields[0])
+		}
+	}
+	return mods, scanner.Err()
+}
+
+// findWorkFile returns the go.work file in effect for dir, considering $GOWORK.
+func findWorkFile(dir string) string {
+	switch gowork := os.Getenv("GOWORK"); gowork {
+	case "off":
+		return ""
+	case "":
+	default:
+		return gowork
+	}
+
+	for {
+		path := filepath.Join(dir, goWorkFile)
+		if fileExists(path) {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func containsString(list []string, str string) bool {
+	for _, entry := range list {
+		if entry == str {
+			return true
+		}
+	}
+	return false
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,185 @@
+package modules
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseModFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    *modFile
+	}{
+		{
+			name:    "module and go version",
+			content: "module example.com/a\n\ngo 1.18\n",
+			want: &modFile{
+				module:    "example.com/a",
+				goVersion: "1.18",
+				requires:  map[string]string{},
+				replaces:  []*replace{},
+				uses:      []string{},
+			},
+		},
+		{
+			name: "require directives and blocks",
+			content: `module example.com/a
+
+require example.com/b v1.0.0
+require (
+	example.com/c v1.2.3 // indirect
+	"example.com/d" v0.1.0
+)
+`,
+			want: &modFile{
+				module: "example.com/a",
+				requires: map[string]string{
+					"example.com/b": "v1.0.0",
+					"example.com/c": "v1.2.3",
+					"example.com/d": "v0.1.0",
+				},
+				replaces: []*replace{},
+				uses:     []string{},
+			},
+		},
+		{
+			name: "replace directives",
+			content: `module example.com/a
+
+replace example.com/b => ../b
+replace (
+	example.com/c v1.0.0 => example.com/fork v1.1.0
+	mylib => ./mylib
+)
+`,
+			want: &modFile{
+				module:   "example.com/a",
+				requires: map[string]string{},
+				replaces: []*replace{
+					{oldPath: "example.com/b", newPath: "../b"},
+					{oldPath: "example.com/c", oldVersion: "v1.0.0", newPath: "example.com/fork", newVersion: "v1.1.0"},
+					{oldPath: "mylib", newPath: "./mylib"},
+				},
+				uses: []string{},
+			},
+		},
+		{
+			name: "go.work use directives",
+			file: goWorkFile,
+			content: `go 1.19
+
+use ./a
+use (
+	./b // comment
+	"./c d"
+)
+`,
+			want: &modFile{
+				goVersion: "1.19",
+				requires:  map[string]string{},
+				replaces:  []*replace{},
+				uses:      []string{"./a", "./b", "./c d"},
+			},
+		},
+		{
+			name:    "directives of newer go versions",
+			content: "module example.com/a\nrequire example.com/b v1.0.0\nreplace example.com/b => ../b\nnewdirective x\n",
+			want: &modFile{
+				module:   "example.com/a",
+				requires: map[string]string{"example.com/b": "v1.0.0"},
+				replaces: []*replace{},
+				uses:     []string{},
+			},
+		},
+		{
+			name:    "unknown directives and comments",
+			content: "// comment\nmodule example.com/a // trailing\nretract v1.0.0\nexclude example.com/b v1.0.0\ntoolchain go1.21.0\n",
+			want: &modFile{
+				module:   "example.com/a",
+				requires: map[string]string{},
+				replaces: []*replace{},
+				uses:     []string{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := tt.file
+			if file == "" {
+				file = goModFile
+			}
+			got, err := parseModFile(writeFile(t, file, tt.content))
+			if err != nil {
+				t.Fatalf("parseModFile() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseModFile() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseModFileErrors(t *testing.T) {
+	if _, err := parseModFile(writeFile(t, goModFile, "module example.com/a\nrequire example.com/b\n")); err == nil {
+		t.Error("parseModFile() expected error for a require without version")
+	}
+	if _, err := parseModFile(writeFile(t, goModFile, "module \"example.com/a\n")); err == nil {
+		t.Error("parseModFile() expected error for an unterminated quoted string")
+	}
+	if _, err := parseModFile(filepath.Join(t.TempDir(), goModFile)); err == nil {
+		t.Error("parseModFile() expected error for a missing file")
+	}
+}
+
+func TestParseGoSum(t *testing.T) {
+	content := `example.com/a v1.0.0 h1:abc=
+example.com/a v1.0.0/go.mod h1:def=
+example.com/a v1.1.0/go.mod h1:ghi=
+example.com/b v0.1.0 h1:jkl=
+
+invalid
+`
+	got, err := parseGoSum(writeFile(t, goSumFile, content))
+	if err != nil {
+		t.Fatalf("parseGoSum() error = %v", err)
+	}
+	want := map[string][]string{
+		"example.com/a": {"v1.0.0", "v1.1.0"},
+		"example.com/b": {"v0.1.0"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseGoSum() = %v, want %v", got, want)
+	}
+}
+
+func TestParseVendorModules(t *testing.T) {
+	content := `# example.com/a v1.0.0
+## explicit; go 1.18
+example.com/a
+example.com/a/sub
+# example.com/b v0.1.0 => ../b
+example.com/b
+# example.com/c => ../c
+`
+	got, err := parseVendorModules(writeFile(t, vendorModsFile, content))
+	if err != nil {
+		t.Fatalf("parseVendorModules() error = %v", err)
+	}
+	want := []string{"example.com/a", "example.com/b", "example.com/c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseVendorModules() = %v, want %v", got, want)
+	}
+}
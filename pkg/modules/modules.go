@@ -2,124 +2,366 @@ package modules
 
 import (
 	"github.com/caos/documentation/pkg/modules/pack"
-	"os"
-	"os/exec"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 )
 
-var cachedModules []*Module
+const stdModule = "std"
 
 type Module struct {
-	basePath       string
-	mod            string
+	cache     *Cache
+	basePath  string
+	mod       string
+	goVersion string
+	requires  map[string]string
+	sums      map[string][]string
+	vendored  map[string]string
+	workspace map[string]string
+	replaces  []*replace
+
+	// guards the caches, the other fields are read-only after loading
+	mu             sync.Mutex
 	cachedImports  map[string]string
 	cachedPackages map[string]*pack.Package
 }
 
+// New returns an empty module with its own cache, modules of a shared cache
+// are created with Cache.Module.
 func New(basePath, mod string) *Module {
 	return &Module{
+		cache:          NewCache(),
 		basePath:       basePath,
 		mod:            mod,
+		requires:       map[string]string{},
+		sums:           map[string][]string{},
+		vendored:       map[string]string{},
+		workspace:      map[string]string{},
+		replaces:       make([]*replace, 0),
 		cachedPackages: map[string]*pack.Package{},
 		cachedImports:  map[string]string{},
 	}
 }
 
-func CachedModule(basePath string) *Module {
-	if cachedModules == nil {
-		cachedModules = make([]*Module, 0)
+// findModuleRoot returns the root directory of the module containing path
+// together with its go.mod. Outside of modules the directory itself or the
+// GOPATH it is located in is used as root.
+func findModuleRoot(path string) (string, *modFile) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return path, &modFile{}
 	}
+	modCache := modCacheDir()
 
-	baseRepoPrefix := filepath.Join(os.ExpandEnv("$GOPATH"), "src") + "/"
-	modPrefix := filepath.Join(os.ExpandEnv("$GOPATH"), "pkg", "mod") + "/"
+	for dir := path; ; {
+		if mf, err := parseModFile(filepath.Join(dir, goModFile)); err == nil {
+			return dir, mf
+		}
 
-	if strings.HasPrefix(basePath, baseRepoPrefix) {
-		path := strings.TrimPrefix(basePath, baseRepoPrefix)
-		mod, _ := getModuleForPath(path)
-		modPath := baseRepoPrefix + mod
+		// modules in the module cache without a go.mod
+		if modCache != "" && strings.Contains(filepath.Base(dir), "@") && strings.HasPrefix(dir, modCache+string(filepath.Separator)) {
+			rel, err := filepath.Rel(modCache, dir)
+			if err == nil {
+				mod := strings.SplitN(filepath.ToSlash(rel), "@", 2)[0]
+				if unescaped, err := module.UnescapePath(mod); err == nil {
+					mod = unescaped
+				}
+				return dir, &modFile{module: mod}
+			}
+		}
 
-		for _, module := range cachedModules {
-			if module.basePath == modPath {
-				return module
+		for _, gopath := range goPaths() {
+			if dir == filepath.Join(gopath, "src") {
+				return dir, &modFile{}
 			}
 		}
-		module := New(modPath, mod)
-		cachedModules = append(cachedModules, module)
-		return module
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return path, &modFile{}
+		}
+		dir = parent
 	}
+}
 
-	mod, _ := getModuleForPath(basePath)
-	modPath := modPrefix + mod
+func (m *Module) load(mf *modFile) {
+	m.goVersion = mf.goVersion
+	for mod, version := range mf.requires {
+		m.requires[mod] = version
+	}
 
-	for _, module := range cachedModules {
-		if module.basePath == modPath {
-			return module
+	if sums, err := parseGoSum(filepath.Join(m.basePath, goSumFile)); err == nil {
+		m.sums = sums
+	}
+
+	// replacements and workspaces only apply to local modules, not to the ones in the module cache
+	modCache := modCacheDir()
+	if m.mod != "" && (modCache == "" || !strings.HasPrefix(m.basePath, modCache)) {
+		m.loadWorkspace()
+		m.addReplaces(m.basePath, mf.replaces)
+	}
+
+	// vendor directories of modules are not used in workspace mode
+	if len(m.workspace) == 0 && m.usesVendor() {
+		vendored, err := parseVendorModules(filepath.Join(m.basePath, vendorDir, vendorModsFile))
+		if err == nil {
+			for _, mod := range vendored {
+				m.vendored[mod] = filepath.Join(m.basePath, vendorDir, filepath.FromSlash(mod))
+			}
 		}
 	}
+}
+
+// moduleFiles returns the files which decide how imports of the module are resolved.
+func (m *Module) moduleFiles() []string {
+	files := []string{
+		filepath.Join(m.basePath, goModFile),
+		filepath.Join(m.basePath, goSumFile),
+		filepath.Join(m.basePath, vendorDir, vendorModsFile),
+	}
+	if workFile := findWorkFile(m.basePath); workFile != "" {
+		files = append(files, workFile)
+	}
+	return files
+}
 
-	module := New(modPath, mod)
-	cachedModules = append(cachedModules, module)
-	return module
+// addReplaces adds replace directives of a go.mod or go.work file in dir,
+// local replacements are resolved relative to dir.
+func (m *Module) addReplaces(dir string, replaces []*replace) {
+	for _, r := range replaces {
+		resolved := *r
+		if resolved.isLocal() && !filepath.IsAbs(resolved.newPath) {
+			resolved.newPath = filepath.Join(dir, filepath.FromSlash(resolved.newPath))
+		}
+		m.replaces = append(m.replaces, &resolved)
+	}
+}
+
+// usesVendor decides like the go command if the vendor directory is used.
+func (m *Module) usesVendor() bool {
+	if !fileExists(filepath.Join(m.basePath, vendorDir, vendorModsFile)) {
+		return false
+	}
+
+	switch modFlag() {
+	case "vendor":
+		return true
+	case "mod", "readonly":
+		return false
+	}
+	return m.mod == stdModule || semver.Compare("v"+m.goVersion, "v1.14") >= 0
+}
+
+func (m *Module) loadWorkspace() {
+	workFile := findWorkFile(m.basePath)
+	if workFile == "" {
+		return
+	}
+
+	wf, err := parseModFile(workFile)
+	if err != nil {
+		return
+	}
+	// replacements in go.work take precedence over the ones in go.mod
+	m.addReplaces(filepath.Dir(workFile), wf.replaces)
+
+	for _, use := range wf.uses {
+		dir := filepath.FromSlash(use)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(workFile), dir)
+		}
+		mf, err := parseModFile(filepath.Join(dir, goModFile))
+		if err != nil || mf.module == "" {
+			continue
+		}
+		m.workspace[mf.module] = dir
+	}
 }
 
 func (m *Module) CachePackage(path string) (ret *pack.Package) {
 
-	localPath := strings.TrimPrefix(path, m.basePath)
+	localPath := m.getImportPath(path)
 
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	for _, cachedPackage := range m.cachedPackages {
 		if cachedPackage.ImportPath == localPath {
 			return cachedPackage
 		}
 	}
 
-	ret = pack.New(path, localPath)
+	ret = pack.New(path, localPath, m.cache.packageOptions())
 	m.cachedPackages[localPath] = ret
 	return ret
 }
 
+// getImportPath returns the import path of the package in the directory path.
+func (m *Module) getImportPath(path string) string {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(m.basePath, absPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	rel = filepath.ToSlash(rel)
+
+	switch {
+	case strings.HasPrefix(rel, vendorDir+"/"):
+		return strings.TrimPrefix(rel, vendorDir+"/")
+	case m.mod == "" || m.mod == stdModule:
+		return rel
+	case rel == ".":
+		return m.mod
+	}
+	return strings.Join([]string{m.mod, rel}, "/")
+}
+
 func (m *Module) GetPathForImport(importPath string) string {
 	if importPath == "" {
 		return ""
 	}
 
+	m.mu.Lock()
 	cached, found := m.cachedImports[importPath]
+	m.mu.Unlock()
 	if found {
 		return cached
 	}
 
-	resultPath := ""
-	if strings.HasPrefix(importPath, m.mod) {
-		resultPath = filepath.Join(os.ExpandEnv("$GOPATH"), "src", importPath)
+	resultPath, source := m.resolveImport(importPath)
+	if resultPath == "" {
+		m.cache.logger.Printf("import %s could not be resolved from module %s", importPath, m.basePath)
 	} else {
-		mod, relativePath := getModuleForPath(importPath)
-		resultPath = filepath.Join(os.ExpandEnv("$GOPATH"), "pkg", "mod", mod, relativePath)
+		m.cache.logger.Printf("import %s resolved to %s from %s", importPath, resultPath, source)
 	}
-
+	m.mu.Lock()
 	m.cachedImports[importPath] = resultPath
+	m.mu.Unlock()
 	return resultPath
 }
 
-func (m *Module) GetModulePath() string {
-	return m.basePath
+// resolveImport returns the directory of the imported package and a
+// description of the source the directory was chosen from.
+func (m *Module) resolveImport(importPath string) (string, string) {
+	if m.mod != "" && m.mod != stdModule && hasPathPrefix(importPath, m.mod) {
+		return joinImportPath(m.basePath, m.mod, importPath), "module " + m.mod
+	}
+
+	main := m.cache.main()
+	modules := []*Module{m}
+	if main != nil && main != m {
+		modules = []*Module{main, m}
+	}
+	for _, module := range modules {
+		if resultPath, source := module.resolveDependency(importPath); resultPath != "" {
+			return resultPath, source
+		}
+	}
+
+	// after the dependencies, as replaced modules can have paths without a dot as well
+	if isStandardImport(importPath) {
+		return filepath.Join(goRoot(), "src", filepath.FromSlash(importPath)), "standard library"
+	}
+
+	for _, gopath := range goPaths() {
+		resultPath := filepath.Join(gopath, "src", filepath.FromSlash(importPath))
+		if dirExists(resultPath) {
+			return resultPath, "GOPATH " + gopath
+		}
+	}
+	return "", ""
 }
 
-func getModuleForPath(path string) (string, string) {
-	levels := strings.Split(path, "/")
+func (m *Module) resolveDependency(importPath string) (string, string) {
+	if mods := prefixModules(importPath, m.workspace); len(mods) > 0 {
+		return joinImportPath(m.workspace[mods[0]], mods[0], importPath), "workspace module " + mods[0]
+	}
 
-	for i := len(levels); i > 0; i-- {
-		localPath := filepath.Join(levels[0:i]...)
-		mod, err := checkGoList(localPath)
-		if err == nil {
-			return strings.Replace(mod, " ", "@", 1), filepath.Join(levels[i:len(levels)]...)
+	if mods := prefixModules(importPath, m.vendored); len(mods) > 0 {
+		return joinImportPath(m.vendored[mods[0]], mods[0], importPath), "vendor directory of " + m.mod
+	}
+
+	if r := m.getReplace(importPath); r != nil {
+		if r.isLocal() {
+			return joinImportPath(r.newPath, r.oldPath, importPath), "replace " + r.oldPath + " => " + r.newPath
+		}
+		modPath := modCachePath(r.newPath, r.newVersion)
+		if dirExists(modPath) {
+			return joinImportPath(modPath, r.oldPath, importPath), "replace " + r.oldPath + " => " + r.newPath + " " + r.newVersion
+		}
+	}
+
+	for _, mod := range prefixModules(importPath, m.requires) {
+		modPath := modCachePath(mod, m.requires[mod])
+		if dirExists(modPath) {
+			return joinImportPath(modPath, mod, importPath), "require " + mod + " " + m.requires[mod]
+		}
+	}
+
+	// modules which are only listed in go.sum, e.g. indirect requirements before go 1.17
+	sumMods := map[string]string{}
+	for mod := range m.sums {
+		sumMods[mod] = mod
+	}
+	for _, mod := range prefixModules(importPath, sumMods) {
+		versions := append([]string{}, m.sums[mod]...)
+		sort.Slice(versions, func(i, j int) bool {
+			return semver.Compare(versions[i], versions[j]) > 0
+		})
+		for _, version := range versions {
+			modPath := modCachePath(mod, version)
+			if dirExists(modPath) {
+				return joinImportPath(modPath, mod, importPath), "go.sum " + mod + " " + version
+			}
 		}
 	}
 	return "", ""
 }
 
-func checkGoList(path string) (string, error) {
-	cmd := exec.Command("sh", "-c", "go list -m "+path)
-	resultPath, err := cmd.CombinedOutput()
-	strPath := string(resultPath)
-	return strings.TrimSuffix(strPath, "\n"), err
+// getReplace returns the replace directive for the most specific module
+// containing the import path. Directives for a version only apply if the
+// module is required in that version.
+func (m *Module) getReplace(importPath string) *replace {
+	var found *replace
+	for _, r := range m.replaces {
+		if !hasPathPrefix(importPath, r.oldPath) {
+			continue
+		}
+		if r.oldVersion != "" && m.requires[r.oldPath] != r.oldVersion {
+			continue
+		}
+		if found == nil || len(r.oldPath) > len(found.oldPath) {
+			found = r
+		}
+	}
+	return found
+}
+
+func (m *Module) GetModulePath() string {
+	return m.basePath
+}
+
+// prefixModules returns the modules which contain the import path, the most
+// specific module first.
+func prefixModules(importPath string, mods map[string]string) []string {
+	prefixes := make([]string, 0)
+	for mod := range mods {
+		if hasPathPrefix(importPath, mod) {
+			prefixes = append(prefixes, mod)
+		}
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		return len(prefixes[i]) > len(prefixes[j])
+	})
+	return prefixes
+}
+
+func joinImportPath(modPath, mod, importPath string) string {
+	rel := strings.TrimPrefix(strings.TrimPrefix(importPath, mod), "/")
+	return filepath.Join(modPath, filepath.FromSlash(rel))
 }
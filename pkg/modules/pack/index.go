@@ -0,0 +1,173 @@
+package pack
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sync"
+)
+
+// TypeDeclaration is the declaration of a type in one of the files of the package.
+type TypeDeclaration struct {
+	File *ast.File
+	Decl *ast.GenDecl
+	Spec *ast.TypeSpec
+}
+
+// ConstDeclaration is the specification of one or more constants with the
+// declaration it is part of.
+type ConstDeclaration struct {
+	Decl *ast.GenDecl
+	Spec *ast.ValueSpec
+}
+
+// Load parses and type checks all files of the package on the first call and
+// indexes the declarations. The importer only has to provide the packages so
+// that qualified identifiers can be resolved. Errors of files which could not
+// be parsed are returned on every call, the files themselves are skipped.
+// Concurrent calls wait for the first one to finish.
+func (p *Package) Load(importer types.Importer) []error {
+	p.loadMu.Lock()
+	defer p.loadMu.Unlock()
+	if p.loaded {
+		return p.parseErrors
+	}
+	p.loaded = true
+
+	p.fset = token.NewFileSet()
+	paths := p.GetGoFileList()
+	files, errs := parseFiles(p.fset, paths, p.options.ParseWorkers)
+	for i := range paths {
+		if errs[i] != nil {
+			p.parseErrors = append(p.parseErrors, errs[i])
+			continue
+		}
+		p.files = append(p.files, files[i])
+		p.index(files[i])
+	}
+
+	p.info = &types.Info{
+		Types:  map[ast.Expr]types.TypeAndValue{},
+		Defs:   map[*ast.Ident]types.Object{},
+		Uses:   map[*ast.Ident]types.Object{},
+		Scopes: map[ast.Node]*types.Scope{},
+	}
+	conf := &types.Config{
+		Importer:    importer,
+		FakeImportC: true,
+		// imported packages are resolved separately, so errors about their
+		// declarations are expected and must not stop the checker
+		Error: func(error) {},
+	}
+	// the returned error is the first one reported to conf.Error and can be ignored
+	p.types, _ = conf.Check(p.ImportPath, p.fset, p.files, p.info)
+
+	return p.parseErrors
+}
+
+// parseFiles parses the files with at most workers in parallel, the results
+// are in the order of paths.
+func parseFiles(fset *token.FileSet, paths []string, workers int) ([]*ast.File, []error) {
+	if workers < 1 {
+		workers = 1
+	}
+	files := make([]*ast.File, len(paths))
+	errs := make([]error, len(paths))
+
+	sem := make(chan struct{}, workers)
+	wg := sync.WaitGroup{}
+	for i := range paths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			files[i], errs[i] = parser.ParseFile(fset, paths[i], nil, parser.ParseComments)
+			<-sem
+		}(i)
+	}
+	wg.Wait()
+	return files, errs
+}
+
+func (p *Package) index(file *ast.File) {
+	for _, decl := range file.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+
+		for _, spec := range gd.Specs {
+			switch s := spec.(type) {
+			case *ast.TypeSpec:
+				if _, found := p.typeDecls[s.Name.Name]; !found {
+					p.typeDecls[s.Name.Name] = &TypeDeclaration{File: file, Decl: gd, Spec: s}
+				}
+			case *ast.ValueSpec:
+				if gd.Tok == token.CONST {
+					p.constDecls = append(p.constDecls, &ConstDeclaration{Decl: gd, Spec: s})
+				}
+			}
+		}
+	}
+}
+
+// Name returns the name of the package as declared in its package clause.
+func (p *Package) Name() string {
+	p.loadMu.Lock()
+	loaded := p.loaded && len(p.files) > 0
+	p.loadMu.Unlock()
+	if loaded {
+		return p.files[0].Name.Name
+	}
+
+	for _, path := range p.GetGoFileList() {
+		file, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.PackageClauseOnly)
+		if err == nil {
+			return file.Name.Name
+		}
+	}
+	return ""
+}
+
+// Doc returns the package doc, the one of doc.go if several files have one.
+func (p *Package) Doc() *ast.CommentGroup {
+	var doc *ast.CommentGroup
+	for _, file := range p.files {
+		if file.Doc == nil {
+			continue
+		}
+		if filepath.Base(p.fset.Position(file.Package).Filename) == "doc.go" {
+			return file.Doc
+		}
+		if doc == nil {
+			doc = file.Doc
+		}
+	}
+	return doc
+}
+
+func (p *Package) Fset() *token.FileSet {
+	return p.fset
+}
+
+func (p *Package) Files() []*ast.File {
+	return p.files
+}
+
+func (p *Package) Types() *types.Package {
+	return p.types
+}
+
+func (p *Package) Info() *types.Info {
+	return p.info
+}
+
+func (p *Package) TypeDeclaration(name string) *TypeDeclaration {
+	return p.typeDecls[name]
+}
+
+func (p *Package) ConstDeclarations() []*ConstDeclaration {
+	return p.constDecls
+}
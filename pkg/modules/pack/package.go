@@ -1,29 +1,137 @@
 package pack
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/caos/documentation/pkg/diagnostics"
 	"github.com/caos/documentation/pkg/treeelement"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 )
 
+// Options decide how the files of packages are selected and parsed.
+type Options struct {
+	// BuildContext decides which files of a package are compiled and therefore documented
+	BuildContext build.Context
+	// ParseWorkers is the maximum number of files of a package parsed at the same time
+	ParseWorkers int
+}
+
+// DefaultOptions returns the options of the environment.
+func DefaultOptions() Options {
+	return Options{
+		BuildContext: build.Default,
+		ParseWorkers: runtime.GOMAXPROCS(0),
+	}
+}
+
+// Package is a directory of go files, it is safe for concurrent use.
 type Package struct {
-	BasePath       string
-	ImportPath     string
-	CachedElements map[string]*treeelement.TreeElement
+	BasePath   string
+	ImportPath string
+	options    Options
+
+	// guards the cached elements and the hash
+	mu             sync.Mutex
+	cachedElements map[string]*CachedElement
+	hash           string
+
+	// guards loading, the loaded fields are read-only afterwards
+	loadMu      sync.Mutex
+	loaded      bool
+	parseErrors []error
+	fset        *token.FileSet
+	files       []*ast.File
+	types       *types.Package
+	info        *types.Info
+	typeDecls   map[string]*TypeDeclaration
+	constDecls  []*ConstDeclaration
 }
 
-func New(basePath, importPath string) *Package {
+func New(basePath, importPath string, options Options) *Package {
 	path := os.ExpandEnv(basePath)
 
 	return &Package{
 		BasePath:       path,
 		ImportPath:     importPath,
-		CachedElements: map[string]*treeelement.TreeElement{},
+		options:        options,
+		cachedElements: map[string]*CachedElement{},
+		typeDecls:      map[string]*TypeDeclaration{},
+	}
+}
+
+// SetBuildConstraints sets the target and build tags used to select the
+// files of packages, empty values keep the defaults of the environment.
+func (o *Options) SetBuildConstraints(goos, goarch string, tags []string) {
+	ctx := build.Default
+	if goos != "" {
+		ctx.GOOS = goos
+	}
+	if goarch != "" {
+		ctx.GOARCH = goarch
+	}
+	ctx.BuildTags = tags
+	o.BuildContext = ctx
+}
+
+// CachedElement is an element built for a type together with what it was built from.
+type CachedElement struct {
+	Element *treeelement.TreeElement
+	// directories of the packages the element was built from
+	Deps []string
+	// diagnostics reported while building, the paths are relative to the element
+	Diagnostics []*diagnostics.Diagnostic
+}
+
+// CachedElement returns the element built for the key, if any.
+func (p *Package) CachedElement(key string) (*CachedElement, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cached, found := p.cachedElements[key]
+	return cached, found
+}
+
+// CacheElement stores the element built for the key.
+func (p *Package) CacheElement(key string, cached *CachedElement) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cachedElements[key] = cached
+}
+
+// Hash returns a hash of the names and contents of the files of the package,
+// it is computed on the first call.
+func (p *Package) Hash() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.hash != "" {
+		return p.hash
 	}
+
+	h := sha256.New()
+	for _, path := range p.GetGoFileList() {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		h.Write([]byte(filepath.Base(path)))
+		h.Write([]byte{0})
+		h.Write(data)
+		h.Write([]byte{0})
+	}
+	p.hash = hex.EncodeToString(h.Sum(nil))
+	return p.hash
 }
 
+// GetGoFileList returns the files which are compiled for the package, test
+// files and files excluded by build constraints are skipped.
 func (p *Package) GetGoFileList() []string {
 	files, err := getFilesInDirectory(p.BasePath)
 	if err != nil {
@@ -32,7 +140,12 @@ func (p *Package) GetGoFileList() []string {
 
 	goFiles := make([]string, 0)
 	for _, file := range files {
-		if !strings.HasSuffix(file, ".go") {
+		name := filepath.Base(file)
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		match, err := p.options.BuildContext.MatchFile(p.BasePath, name)
+		if err != nil || !match {
 			continue
 		}
 		goFiles = append(goFiles, file)
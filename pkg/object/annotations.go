@@ -0,0 +1,84 @@
+package object
+
+import (
+	"regexp"
+	"strings"
+)
+
+// directive matches comment lines like @since: v1.2 or @hidden
+var directive = regexp.MustCompile(`^@([a-zA-Z][\w-]*)(?::\s*(.*)|\s+(.*))?$`)
+
+// the directives which can be used in comments
+const (
+	directiveDefault    = "default"
+	directiveExample    = "example"
+	directiveDeprecated = "deprecated"
+	directiveSince      = "since"
+	directiveRequired   = "required"
+	directiveSee        = "see"
+	directiveHidden     = "hidden"
+)
+
+// Annotations are the directives of a comment besides @default.
+type Annotations struct {
+	// Example is a snippet of the attribute, several @example lines are joined
+	// and @example: | takes the indented lines following it
+	Example    string
+	Deprecated bool
+	// DeprecationNote is the reason or replacement given with @deprecated
+	DeprecationNote string
+	Since           string
+	Required        bool
+	See             []string
+	Hidden          bool
+	// Unknown are the names of directives which are not supported
+	Unknown []string
+}
+
+// IsDirective checks if the comment line is a directive like @since: v1.2.
+func IsDirective(line string) bool {
+	return directive.MatchString(strings.TrimSpace(line))
+}
+
+func parseDirective(line string) (string, string, bool) {
+	match := directive.FindStringSubmatch(strings.TrimSpace(line))
+	if match == nil {
+		return empty, empty, false
+	}
+	return match[1], strings.TrimSpace(match[2] + match[3]), true
+}
+
+// GetAnnotations parses the directives of the comments.
+func (o *Object) GetAnnotations() *Annotations {
+	annotations := &Annotations{}
+	split := o.splitComments()
+	for _, line := range split.lines {
+		name, value, ok := parseDirective(line)
+		if !ok {
+			continue
+		}
+
+		switch name {
+		case directiveDefault:
+		case directiveDeprecated:
+			annotations.Deprecated = true
+			annotations.DeprecationNote = value
+		case directiveSince:
+			annotations.Since = value
+		case directiveRequired:
+			annotations.Required = true
+		case directiveSee:
+			for _, see := range strings.Split(value, ",") {
+				if see = strings.TrimSpace(see); see != empty {
+					annotations.See = append(annotations.See, see)
+				}
+			}
+		case directiveHidden:
+			annotations.Hidden = true
+		default:
+			annotations.Unknown = append(annotations.Unknown, name)
+		}
+	}
+	annotations.Example = strings.Join(split.examples, newLine)
+	return annotations
+}
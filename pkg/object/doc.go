@@ -0,0 +1,72 @@
+package object
+
+import (
+	"go/doc/comment"
+	"strings"
+)
+
+// QualifyDocLinks parses the doc comment text and rewrites its doc links to
+// their import paths, e.g. [Foo] to [example.com/pkg.Foo] and [json.Marshal]
+// to [encoding/json.Marshal], so that they can be resolved without the file
+// they were written in. Imports maps the package names of the file to their
+// import paths, unqualified links are resolved in the package importPath if
+// lookupSym reports that it declares them.
+func QualifyDocLinks(text, importPath string, imports map[string]string, lookupSym func(recv, name string) bool) string {
+	if strings.TrimSpace(text) == empty {
+		return empty
+	}
+
+	parser := &comment.Parser{
+		LookupPackage: func(name string) (string, bool) {
+			path, found := imports[name]
+			return path, found
+		},
+		LookupSym: func(recv, name string) bool {
+			return importPath != empty && lookupSym != nil && lookupSym(recv, name)
+		},
+	}
+	doc := parser.Parse(text)
+	for _, block := range doc.Content {
+		qualifyBlock(block, importPath)
+	}
+
+	printer := &comment.Printer{}
+	return strings.TrimSuffix(string(printer.Comment(doc)), newLine)
+}
+
+func qualifyBlock(block comment.Block, importPath string) {
+	switch b := block.(type) {
+	case *comment.Paragraph:
+		qualifyText(b.Text, importPath)
+	case *comment.Heading:
+		qualifyText(b.Text, importPath)
+	case *comment.List:
+		for _, item := range b.Items {
+			for _, content := range item.Content {
+				qualifyBlock(content, importPath)
+			}
+		}
+	}
+}
+
+func qualifyText(texts []comment.Text, importPath string) {
+	for _, text := range texts {
+		link, ok := text.(*comment.DocLink)
+		if !ok {
+			continue
+		}
+		if link.ImportPath == empty {
+			link.ImportPath = importPath
+		}
+
+		name := link.Name
+		if link.Recv != empty {
+			name = strings.Join([]string{link.Recv, link.Name}, ".")
+		}
+		if name == empty {
+			link.Text = []comment.Text{comment.Plain(link.ImportPath)}
+		} else {
+			link.Text = []comment.Text{comment.Plain(strings.Join([]string{link.ImportPath, name}, "."))}
+		}
+	}
+}
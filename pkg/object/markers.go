@@ -0,0 +1,131 @@
+package object
+
+import (
+	"github.com/caos/documentation/pkg/treeelement"
+	"regexp"
+	"strings"
+)
+
+const (
+	markerPrefix     = "+"
+	kubebuilder      = "kubebuilder:"
+	validationPrefix = "kubebuilder:validation:"
+)
+
+// marker matches comment lines like +optional or +kubebuilder:default=1
+var marker = regexp.MustCompile(`^\+[a-zA-Z][\w.\-/]*(:[\w.\-/]+)*(:?=.*)?$`)
+
+// validationMarkers maps kubebuilder validation markers to the names of the
+// equivalent rules of validate tags
+var validationMarkers = map[string]string{
+	"Minimum":          "gte",
+	"Maximum":          "lte",
+	"ExclusiveMinimum": "gt",
+	"ExclusiveMaximum": "lt",
+	"MinLength":        "min",
+	"MaxLength":        "max",
+	"MinItems":         "min",
+	"MaxItems":         "max",
+	"MinProperties":    "min",
+	"MaxProperties":    "max",
+	"Pattern":          "pattern",
+	"Format":           "format",
+	"MultipleOf":       "multipleOf",
+	"UniqueItems":      "unique",
+}
+
+// Markers are the kubebuilder style markers of a comment, as read by controller-gen.
+type Markers struct {
+	Default     string
+	HasDefault  bool
+	Optional    bool
+	Required    bool
+	Enum        []string
+	Constraints []*treeelement.Constraint
+}
+
+// IsMarker checks if the comment line is a marker like +optional.
+func IsMarker(line string) bool {
+	return marker.MatchString(strings.TrimSpace(line))
+}
+
+// StripMarkers removes the marker lines from a comment.
+func StripMarkers(comments string) string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(comments, newLine) {
+		if !IsMarker(line) {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, newLine)
+}
+
+// ParseMarkers reads the markers of a comment, unknown markers are ignored.
+func ParseMarkers(comments string) *Markers {
+	markers := &Markers{}
+	// exclusive bounds turn the bounds of Minimum and Maximum into strict ones,
+	// independent of the order of the markers
+	exclusive := map[string]bool{}
+	for _, line := range strings.Split(comments, newLine) {
+		line = strings.TrimSpace(line)
+		if !IsMarker(line) {
+			continue
+		}
+
+		name, value := strings.TrimPrefix(line, markerPrefix), empty
+		if idx := strings.Index(name, "="); idx >= 0 {
+			name, value = strings.TrimSuffix(name[:idx], ":"), strings.TrimSpace(name[idx+1:])
+		}
+
+		switch {
+		case name == "optional" || name == validationPrefix+"Optional":
+			markers.Optional = true
+		case name == "required" || name == validationPrefix+"Required":
+			markers.Required = true
+		case name == kubebuilder+"default":
+			markers.Default = unquote(value)
+			markers.HasDefault = true
+		case name == validationPrefix+"Enum":
+			for _, enum := range strings.Split(value, ";") {
+				markers.Enum = append(markers.Enum, unquote(strings.TrimSpace(enum)))
+			}
+		case name == validationPrefix+"ExclusiveMinimum" || name == validationPrefix+"ExclusiveMaximum":
+			exclusive[validationMarkers[strings.TrimPrefix(name, validationPrefix)]] = value != "false"
+		case strings.HasPrefix(name, validationPrefix):
+			markers.addConstraint(strings.TrimPrefix(name, validationPrefix), value)
+		}
+	}
+
+	for _, constraint := range markers.Constraints {
+		// gt and lt are the strict rules of gte and lte
+		if strict := strings.TrimSuffix(constraint.Name, "e"); exclusive[strict] {
+			constraint.Name = strict
+		}
+	}
+	return markers
+}
+
+func (m *Markers) addConstraint(name, value string) {
+	rule, found := validationMarkers[name]
+	if !found {
+		rule = strings.ToLower(name[:1]) + name[1:]
+	}
+
+	if name == "UniqueItems" {
+		if value == "false" {
+			return
+		}
+		value = empty
+	}
+	m.Constraints = append(m.Constraints, &treeelement.Constraint{Name: rule, Value: unquote(value)})
+}
+
+// unquote removes the double quotes or backticks of a string value of a marker.
+func unquote(value string) string {
+	for _, quote := range []string{`"`, "`"} {
+		if len(value) >= 2 && strings.HasPrefix(value, quote) && strings.HasSuffix(value, quote) {
+			return value[1 : len(value)-1]
+		}
+	}
+	return value
+}
@@ -0,0 +1,133 @@
+package object
+
+import (
+	"github.com/caos/documentation/pkg/treeelement"
+	"reflect"
+	"testing"
+)
+
+func TestIsMarker(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{line: "+optional", want: true},
+		{line: "  +required", want: true},
+		{line: "+kubebuilder:default=1", want: true},
+		{line: "+kubebuilder:validation:Enum=a;b", want: true},
+		{line: "+kubebuilder:validation:Pattern:=`^a$`", want: true},
+		{line: "+k8s:openapi-gen=true", want: true},
+		{line: "+groupName=example.com", want: true},
+		{line: "+1 for this field", want: false},
+		{line: "+ optional", want: false},
+		{line: "optional", want: false},
+		{line: "a + b", want: false},
+		{line: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			if got := IsMarker(tt.line); got != tt.want {
+				t.Errorf("IsMarker() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripMarkers(t *testing.T) {
+	comments := "Replicas is the number of pods.\n+optional\n+kubebuilder:validation:Minimum=0\nDefaults to 1.\n"
+	want := "Replicas is the number of pods.\nDefaults to 1.\n"
+	if got := StripMarkers(comments); got != want {
+		t.Errorf("StripMarkers() = %q, want %q", got, want)
+	}
+}
+
+func TestParseMarkers(t *testing.T) {
+	tests := []struct {
+		name     string
+		comments string
+		want     *Markers
+	}{
+		{
+			name:     "no markers",
+			comments: "Name of the object.\n",
+			want:     &Markers{},
+		},
+		{
+			name:     "optional",
+			comments: "+optional\n",
+			want:     &Markers{Optional: true},
+		},
+		{
+			name:     "validation optional and required",
+			comments: "+kubebuilder:validation:Optional\n+kubebuilder:validation:Required\n",
+			want:     &Markers{Optional: true, Required: true},
+		},
+		{
+			name:     "quoted default",
+			comments: "+kubebuilder:default=\"info\"\n",
+			want:     &Markers{Default: "info", HasDefault: true},
+		},
+		{
+			name:     "empty default",
+			comments: "+kubebuilder:default=\n",
+			want:     &Markers{HasDefault: true},
+		},
+		{
+			name:     "enum",
+			comments: "+kubebuilder:validation:Enum=debug;\"info\"; warn\n",
+			want:     &Markers{Enum: []string{"debug", "info", "warn"}},
+		},
+		{
+			name:     "bounds",
+			comments: "+kubebuilder:validation:Minimum=1\n+kubebuilder:validation:Maximum=10\n+kubebuilder:validation:ExclusiveMaximum=true\n",
+			want: &Markers{Constraints: []*treeelement.Constraint{
+				{Name: "gte", Value: "1"},
+				{Name: "lt", Value: "10"},
+			}},
+		},
+		{
+			name:     "exclusive bound before the bound",
+			comments: "+kubebuilder:validation:ExclusiveMinimum=true\n+kubebuilder:validation:Minimum=1\n+kubebuilder:validation:MinLength=2\n",
+			want: &Markers{Constraints: []*treeelement.Constraint{
+				{Name: "gt", Value: "1"},
+				{Name: "min", Value: "2"},
+			}},
+		},
+		{
+			name:     "exclusive false keeps the bound inclusive",
+			comments: "+kubebuilder:validation:Minimum=1\n+kubebuilder:validation:ExclusiveMinimum=false\n",
+			want: &Markers{Constraints: []*treeelement.Constraint{
+				{Name: "gte", Value: "1"},
+			}},
+		},
+		{
+			name:     "lengths, pattern and unknown rules",
+			comments: "+kubebuilder:validation:MaxLength=63\n+kubebuilder:validation:Pattern:=`^[a-z]+$`\n+kubebuilder:validation:Pattern=\"^a$\"\n+kubebuilder:validation:XIntOrString\n",
+			want: &Markers{Constraints: []*treeelement.Constraint{
+				{Name: "max", Value: "63"},
+				{Name: "pattern", Value: "^[a-z]+$"},
+				{Name: "pattern", Value: "^a$"},
+				{Name: "xIntOrString"},
+			}},
+		},
+		{
+			name:     "unique items",
+			comments: "+kubebuilder:validation:UniqueItems=true\n+kubebuilder:validation:UniqueItems=false\n",
+			want: &Markers{Constraints: []*treeelement.Constraint{
+				{Name: "unique"},
+			}},
+		},
+		{
+			name:     "unknown markers are ignored",
+			comments: "+k8s:deepcopy-gen=true\n+listType=map\n",
+			want:     &Markers{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseMarkers(tt.comments); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseMarkers() = %+v (constraints %s), want %+v (constraints %s)", got, constraintsString(got.Constraints), tt.want, constraintsString(tt.want.Constraints))
+			}
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package object
 
 import (
+	"github.com/caos/documentation/pkg/treeelement"
 	"github.com/fatih/structtag"
+	"regexp"
+	"sigs.k8s.io/yaml"
 	"strings"
 )
 
@@ -13,13 +16,35 @@ type Object struct {
 	PackageName string
 	MapType     bool
 	Mapkey      string
+	Pointer     bool
+	// Embedded is set for anonymous fields, which are named after their type
+	Embedded bool
+	// Default is the default found in the code, it takes precedence over annotations
+	Default string
+	// Format is the tag key the attribute name is read from, e.g. yaml
+	Format string
+	// ImportPath is the import path of the package the comments are written in
+	ImportPath string
+	// Imports maps the package names of the file the comments are written in to their import paths
+	Imports map[string]string
+	// LookupSym reports if the package declares the symbol, doc links to other symbols are kept as text
+	LookupSym func(recv, name string) bool
 }
 
+// validateKey is the tag key of go-playground/validator
+const validateKey = "validate"
+
+// oneOfValue matches the values of oneof, which can be quoted with single quotes
+var oneOfValue = regexp.MustCompile(`'[^']*'|\S+`)
+
 const (
-	defPrefix = "@default:"
-	newLine   = "\n"
-	space     = " "
-	empty     = ""
+	defPrefix     = "@default:"
+	examplePrefix = "@example"
+	// blockIndicator starts a default or an example spanning the following indented lines
+	blockIndicator = "|"
+	newLine        = "\n"
+	space          = " "
+	empty          = ""
 )
 
 func (o *Object) GetFieldName() string {
@@ -37,79 +62,325 @@ func (o *Object) GetAttributeName(format string) string {
 	}
 
 	yml, err := tags.Get(format)
-	if err != nil {
-		firstLetter := strings.ToLower(string(o.Fieldname[0]))
-		rest := o.Fieldname[1:]
-		return strings.Join([]string{firstLetter, rest}, empty)
+	if err != nil || yml.Name == empty {
+		// tags with options only, e.g. ",omitempty", don't name the field
+		return o.untaggedName(format)
 	}
 
 	return yml.Name
 }
 
+// IsTagged checks if the tag of the format names the field, encoding/json
+// prefers tagged fields of embedded structs over untagged ones.
+func (o *Object) IsTagged(format string) bool {
+	tag, err := o.getTag(format)
+	return err == nil && tag.Name != empty
+}
+
+// untaggedName returns the name the encoder of the format uses for fields
+// without a tag.
+func (o *Object) untaggedName(format string) string {
+	switch format {
+	case "json", "toml", "mapstructure", "env":
+		return o.Fieldname
+	}
+	firstLetter := strings.ToLower(string(o.Fieldname[0]))
+	rest := o.Fieldname[1:]
+	return strings.Join([]string{firstLetter, rest}, empty)
+}
+
+// SelectFormat returns the first of the formats the field has a tag for, or
+// the first format if it has none of them.
+func (o *Object) SelectFormat(formats []string) string {
+	if len(formats) == 0 {
+		return empty
+	}
+
+	tag := strings.TrimSuffix(strings.TrimPrefix(o.Tag, "`"), "`")
+	tags, err := structtag.Parse(tag)
+	if err != nil {
+		return formats[0]
+	}
+	for _, format := range formats {
+		if _, err := tags.Get(format); err == nil {
+			return format
+		}
+	}
+	return formats[0]
+}
+
 func (o *Object) IsCollection() bool {
 	return o.Collection
 }
 
+// IsInline checks if the attributes of the field are flattened into the
+// struct it is declared in, the way the encoder of the format does it. yaml
+// inlines fields with the option inline and mapstructure the ones with the
+// option squash. json and toml promote the fields of embedded structs which
+// have no name in their tag and env flattens all embedded structs.
 func (o *Object) IsInline(format string) bool {
-	tag := strings.TrimSuffix(strings.TrimPrefix(o.Tag, "`"), "`")
-	tags, err := structtag.Parse(tag)
+	tag, err := o.getTag(format)
+	switch format {
+	case "json", "toml":
+		return o.Embedded && (err != nil || tag.Name == empty)
+	case "env":
+		return o.Embedded
+	}
 	if err != nil {
 		return false
 	}
 
-	yml, err := tags.Get(format)
-	if err == nil {
-		for _, option := range yml.Options {
-			if option == "inline" {
-				return true
+	option := "inline"
+	if format == "mapstructure" {
+		option = "squash"
+	}
+	return tag.HasOption(option)
+}
+
+// IsIgnored checks if the decoder of the format ignores the field because of
+// a "-" tag.
+func (o *Object) IsIgnored(format string) bool {
+	tag, err := o.getTag(format)
+	if err != nil {
+		return false
+	}
+	return tag.Name == "-" && len(tag.Options) == 0
+}
+
+// IsOptional checks if the field can be left out, which is the case for
+// pointers and for fields tagged with omitempty.
+func (o *Object) IsOptional(format string) bool {
+	if o.Pointer {
+		return true
+	}
+
+	tag, err := o.getTag(format)
+	if err != nil {
+		return false
+	}
+	return tag.HasOption("omitempty")
+}
+
+// GetConstraints parses the validate tag and the validation markers of the
+// field, rules following dive apply to the items of collections and maps.
+func (o *Object) GetConstraints() []*treeelement.Constraint {
+	constraints := ParseMarkers(o.Comments).Constraints
+	tag, err := o.getTag(validateKey)
+	if err != nil {
+		return constraints
+	}
+
+	items := false
+	for _, rule := range append([]string{tag.Name}, tag.Options...) {
+		name, value := rule, empty
+		if idx := strings.Index(rule, "="); idx >= 0 {
+			name, value = rule[:idx], rule[idx+1:]
+		}
+		// commas and pipes in parameters are escaped by validator
+		value = strings.NewReplacer("0x2C", ",", "0x7C", "|").Replace(value)
+
+		switch name {
+		case empty, "omitempty", "keys", "endkeys":
+			continue
+		case "dive":
+			items = true
+			continue
+		}
+
+		constraint := &treeelement.Constraint{Name: name, Value: value, Items: items}
+		if name == "oneof" {
+			for _, oneOf := range oneOfValue.FindAllString(value, -1) {
+				constraint.Values = append(constraint.Values, strings.Trim(oneOf, "'"))
 			}
 		}
+		constraints = append(constraints, constraint)
 	}
+	return constraints
+}
 
-	return false
+// IsRequired checks if the field has to be set. Markers like +optional and
+// @required decide first, then the validate tag and at last if the field can be left out when
+// encoding.
+func (o *Object) IsRequired(format string) bool {
+	markers := ParseMarkers(o.Comments)
+	switch {
+	case markers.Required || o.GetAnnotations().Required:
+		return true
+	case markers.Optional:
+		return false
+	}
+
+	for _, constraint := range o.GetConstraints() {
+		if constraint.Name == "required" && !constraint.Items {
+			return true
+		}
+	}
+	return !o.IsOptional(format)
 }
 
-func (o *Object) GetDescription() string {
-	desc := empty
-	lines := strings.Split(o.Comments, newLine)
-	trimedLines := make([]string, 0)
-	for _, line := range lines {
-		trimedLines = append(trimedLines, strings.Trim(line, space))
+func (o *Object) getTag(format string) (*structtag.Tag, error) {
+	tag := strings.TrimSuffix(strings.TrimPrefix(o.Tag, "`"), "`")
+	tags, err := structtag.Parse(tag)
+	if err != nil {
+		return nil, err
 	}
+	return tags.Get(format)
+}
 
-	for _, line := range trimedLines {
-		if strings.HasPrefix(line, defPrefix) {
+// GetDescription returns the doc comment without defaults, directives and
+// markers, with its doc links qualified by QualifyDocLinks.
+func (o *Object) GetDescription() string {
+	desc := make([]string, 0)
+	for _, line := range o.splitComments().lines {
+		trimedLine := strings.Trim(line, space)
+		if strings.HasPrefix(trimedLine, defPrefix) || IsDirective(trimedLine) || IsMarker(trimedLine) {
 			continue
-		} else {
-			if desc == empty {
-				desc = line
-			} else {
-				desc = strings.Join([]string{desc, line}, space)
-			}
 		}
+		desc = append(desc, line)
 	}
 
-	return desc
+	return QualifyDocLinks(strings.Join(desc, newLine), o.ImportPath, o.Imports, o.LookupSym)
 }
 
+// GetDefaultValue returns the default of the attribute, block defaults span
+// several lines, e.g. a list or an object.
 func (o *Object) GetDefaultValue() string {
-	def := empty
+	def, _ := o.GetDefault()
+	return def
+}
 
+// GetDefault returns the default of the attribute and if it is a block
+// default, which is given by the indented lines following @default: |
+func (o *Object) GetDefault() (string, bool) {
+	if o.Default != empty {
+		return o.Default, false
+	}
+
+	def := o.splitComments().def
+	if def == nil {
+		if markers := ParseMarkers(o.Comments); markers.HasDefault {
+			return markers.Default, false
+		}
+		return empty, false
+	}
+	return def.value, def.block
+}
+
+// GetDefaultData returns the block default decoded as YAML into the values
+// encoding/json decodes into, e.g. []interface{} for a list, for
+// machine-readable outputs. Defaults on a single line are only kept as text,
+// as their type depends on the field.
+func (o *Object) GetDefaultData() (interface{}, error) {
+	def, block := o.GetDefault()
+	if !block {
+		return nil, nil
+	}
+
+	var data interface{}
+	if err := yaml.Unmarshal([]byte(def), &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+type commentDefault struct {
+	value string
+	block bool
+}
+
+// commentParts are the comments without the lines of defaults and examples.
+type commentParts struct {
+	lines []string
+	// the last default of the comments
+	def *commentDefault
+	// the examples of the comments, block examples are dedented
+	examples []string
+}
+
+// splitComments splits off the defaults and the examples of the comments,
+// both can be given on a line or as block of the indented lines following
+// @default: | or @example: |
+func (o *Object) splitComments() *commentParts {
 	lines := strings.Split(o.Comments, newLine)
-	trimedLines := make([]string, 0)
-	for _, line := range lines {
-		trimedLine := strings.Trim(line, space)
-		if trimedLine != empty {
-			trimedLines = append(trimedLines, trimedLine)
+	split := &commentParts{lines: make([]string, 0, len(lines)), examples: make([]string, 0)}
+	for i := 0; i < len(lines); i++ {
+		trimedLine := strings.Trim(lines[i], space)
+		prefix := defPrefix
+		if !strings.HasPrefix(trimedLine, defPrefix) {
+			if !isExample(trimedLine) {
+				split.lines = append(split.lines, lines[i])
+				continue
+			}
+			prefix = examplePrefix
 		}
+
+		value := strings.TrimPrefix(trimedLine, prefix)
+		block := strings.TrimSpace(strings.TrimPrefix(value, ":")) == blockIndicator
+		if block {
+			body := make([]string, 0)
+			for i+1 < len(lines) && (strings.TrimSpace(lines[i+1]) == empty || isIndented(lines[i+1])) {
+				i++
+				body = append(body, lines[i])
+			}
+			value = dedent(body)
+		}
+
+		if prefix == defPrefix {
+			split.def = &commentDefault{value: value, block: block}
+			continue
+		}
+		if !block {
+			// only the separator is dropped, the indentation of snippets spanning several lines is kept
+			value = strings.TrimPrefix(strings.TrimPrefix(value, ":"), space)
+		}
+		split.examples = append(split.examples, value)
+	}
+	return split
+}
+
+// isExample checks if the comment line is an @example directive.
+func isExample(line string) bool {
+	name, _, ok := parseDirective(line)
+	return ok && name == directiveExample
+}
+
+func isIndented(line string) bool {
+	return strings.HasPrefix(line, space) || strings.HasPrefix(line, "\t")
+}
+
+// dedent removes the indentation all lines have in common and the trailing empty lines.
+func dedent(lines []string) string {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == empty {
+		lines = lines[:len(lines)-1]
 	}
 
-	for _, line := range trimedLines {
-		if strings.HasPrefix(line, defPrefix) {
-			def = strings.TrimPrefix(line, defPrefix)
-		} else {
+	indent := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == empty {
 			continue
 		}
+		if width := len(line) - len(strings.TrimLeft(line, " \t")); indent < 0 || width < indent {
+			indent = width
+		}
 	}
-	return def
+
+	dedented := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if len(line) < indent {
+			line = empty
+		} else if indent > 0 {
+			line = line[indent:]
+		}
+		dedented = append(dedented, line)
+	}
+	return strings.Join(dedented, newLine)
+}
+
+// GetEnum returns the values allowed by a +kubebuilder:validation:Enum marker.
+func (o *Object) GetEnum() []*treeelement.EnumValue {
+	enum := make([]*treeelement.EnumValue, 0)
+	for _, value := range ParseMarkers(o.Comments).Enum {
+		enum = append(enum, &treeelement.EnumValue{Value: value})
+	}
+	return enum
 }
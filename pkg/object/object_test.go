@@ -0,0 +1,239 @@
+package object
+
+import (
+	"github.com/caos/documentation/pkg/treeelement"
+	"reflect"
+	"testing"
+)
+
+func TestGetConstraints(t *testing.T) {
+	tests := []struct {
+		name     string
+		tag      string
+		comments string
+		want     []*treeelement.Constraint
+	}{
+		{
+			name: "no validate tag",
+			tag:  "`yaml:\"name\"`",
+		},
+		{
+			name: "rules with parameters",
+			tag:  "`validate:\"required,min=1,max=10\"`",
+			want: []*treeelement.Constraint{
+				{Name: "required"},
+				{Name: "min", Value: "1"},
+				{Name: "max", Value: "10"},
+			},
+		},
+		{
+			name: "omitempty is no rule",
+			tag:  "`validate:\"omitempty,email\"`",
+			want: []*treeelement.Constraint{
+				{Name: "email"},
+			},
+		},
+		{
+			name: "oneof values",
+			tag:  "`validate:\"oneof=red 'light blue' green\"`",
+			want: []*treeelement.Constraint{
+				{Name: "oneof", Value: "red 'light blue' green", Values: []string{"red", "light blue", "green"}},
+			},
+		},
+		{
+			name: "escaped commas and pipes",
+			tag:  "`validate:\"contains=a0x2Cb,excludes=0x7C\"`",
+			want: []*treeelement.Constraint{
+				{Name: "contains", Value: "a,b"},
+				{Name: "excludes", Value: "|"},
+			},
+		},
+		{
+			name: "rules after dive apply to the items",
+			tag:  "`validate:\"required,dive,keys,alpha,endkeys,min=2\"`",
+			want: []*treeelement.Constraint{
+				{Name: "required"},
+				{Name: "alpha", Items: true},
+				{Name: "min", Value: "2", Items: true},
+			},
+		},
+		{
+			name:     "markers before the validate tag",
+			tag:      "`validate:\"max=5\"`",
+			comments: "+kubebuilder:validation:Minimum=1\n",
+			want: []*treeelement.Constraint{
+				{Name: "gte", Value: "1"},
+				{Name: "max", Value: "5"},
+			},
+		},
+		{
+			name: "invalid tag",
+			tag:  "`validate:required`",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Object{Tag: tt.tag, Comments: tt.comments}
+			if got := o.GetConstraints(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetConstraints() = %s, want %s", constraintsString(got), constraintsString(tt.want))
+			}
+		})
+	}
+}
+
+func TestIsRequired(t *testing.T) {
+	tests := []struct {
+		name     string
+		tag      string
+		comments string
+		pointer  bool
+		want     bool
+	}{
+		{name: "plain field", tag: "`yaml:\"name\"`", want: true},
+		{name: "omitempty", tag: "`yaml:\"name,omitempty\"`", want: false},
+		{name: "pointer", tag: "`yaml:\"name\"`", pointer: true, want: false},
+		{name: "validate required", tag: "`yaml:\"name,omitempty\" validate:\"required\"`", want: true},
+		{name: "required items only", tag: "`yaml:\"name,omitempty\" validate:\"dive,required\"`", want: false},
+		{name: "optional marker", tag: "`yaml:\"name\" validate:\"required\"`", comments: "+optional\n", want: false},
+		{name: "required marker", tag: "`yaml:\"name,omitempty\"`", comments: "+required\n", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Object{Tag: tt.tag, Comments: tt.comments, Pointer: tt.pointer}
+			if got := o.IsRequired("yaml"); got != tt.want {
+				t.Errorf("IsRequired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func constraintsString(constraints []*treeelement.Constraint) string {
+	s := "["
+	for _, constraint := range constraints {
+		s += " " + constraint.Name + "=" + constraint.Value
+		if constraint.Items {
+			s += "(items)"
+		}
+	}
+	return s + " ]"
+}
+
+func TestGetAnnotationsExample(t *testing.T) {
+	tests := []struct {
+		name     string
+		comments string
+		example  string
+		desc     string
+	}{
+		{
+			name:     "single line",
+			comments: "Address to listen on\n@example: address: 0.0.0.0:8080\n",
+			example:  "address: 0.0.0.0:8080",
+			desc:     "Address to listen on",
+		},
+		{
+			name:     "lines keep their indentation",
+			comments: "Spec of the app\n@example: spec:\n@example:   replicas: 1\n",
+			example:  "spec:\n  replicas: 1",
+			desc:     "Spec of the app",
+		},
+		{
+			name:     "block",
+			comments: "Spec of the app\n@example: |\n  spec:\n    replicas: 1\n\n    image: app\nMore about the spec\n",
+			example:  "spec:\n  replicas: 1\n\n  image: app",
+			desc:     "Spec of the app\nMore about the spec",
+		},
+		{
+			name:     "block and default block",
+			comments: "Ports\n@default: |\n  - 80\n@example: |\n  - 8080\n  - 8443\n",
+			example:  "- 8080\n- 8443",
+			desc:     "Ports",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Object{Comments: tt.comments}
+			if got := o.GetAnnotations().Example; got != tt.example {
+				t.Errorf("GetAnnotations().Example = %q, want %q", got, tt.example)
+			}
+			if got := o.GetDescription(); got != tt.desc {
+				t.Errorf("GetDescription() = %q, want %q", got, tt.desc)
+			}
+		})
+	}
+}
+
+func TestGetAttributeName(t *testing.T) {
+	tests := []struct {
+		name   string
+		tag    string
+		format string
+		want   string
+	}{
+		{name: "yaml tag", tag: "`yaml:\"max_size\"`", format: "yaml", want: "max_size"},
+		{name: "yaml untagged", format: "yaml", want: "maxSize"},
+		{name: "yaml options only", tag: "`yaml:\",omitempty\"`", format: "yaml", want: "maxSize"},
+		{name: "json options only", tag: "`json:\",omitempty\"`", format: "json", want: "MaxSize"},
+		{name: "other format", tag: "`json:\"maxSize\"`", format: "toml", want: "MaxSize"},
+		{name: "invalid tag", tag: "`yaml:max_size`", format: "yaml", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Object{Fieldname: "MaxSize", Tag: tt.tag}
+			if got := o.GetAttributeName(tt.format); got != tt.want {
+				t.Errorf("GetAttributeName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDefaultData(t *testing.T) {
+	tests := []struct {
+		name     string
+		comments string
+		want     interface{}
+		wantErr  bool
+	}{
+		{
+			name:     "single line",
+			comments: "@default: 8080\n",
+		},
+		{
+			name:     "list of objects",
+			comments: "@default: |\n  - name: http\n    port: 80\n    tls: false\n",
+			want: []interface{}{
+				map[string]interface{}{"name": "http", "port": float64(80), "tls": false},
+			},
+		},
+		{
+			name:     "block scalar and anchor",
+			comments: "@default: |\n  base: &base\n    image: app\n  script: |\n    echo\n  copy: *base\n",
+			want: map[string]interface{}{
+				"base":   map[string]interface{}{"image": "app"},
+				"script": "echo\n",
+				"copy":   map[string]interface{}{"image": "app"},
+			},
+		},
+		{
+			name:     "multi-line plain scalar",
+			comments: "@default: |\n  a long\n  sentence\n",
+			want:     "a long sentence",
+		},
+		{
+			name:     "invalid",
+			comments: "@default: |\n  a: [b\n",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&Object{Comments: tt.comments}).GetDefaultData()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetDefaultData() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetDefaultData() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
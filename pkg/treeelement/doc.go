@@ -0,0 +1,185 @@
+package treeelement
+
+import (
+	"go/doc/comment"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	docBaseURL = "https://pkg.go.dev"
+	lineBreak  = "<br>"
+)
+
+// Pages maps the qualified names of the documented types, e.g.
+// example.com/pkg.Foo, to the files of their pages, doc links to the types
+// link to these pages.
+type Pages map[string]string
+
+// Add adds the page of the element if its type has no page yet.
+func (p Pages) Add(element *TreeElement, file string) {
+	key := strings.Join([]string{element.GoImportPath, element.GoType}, ".")
+	if _, found := p[key]; !found {
+		p[key] = file
+	}
+}
+
+// docRenderer renders the doc comments of a page, descriptions are doc
+// comment text with qualified doc links, see object.QualifyDocLinks.
+type docRenderer struct {
+	pages Pages
+	// dir is the directory of the page, links are relative to it
+	dir string
+	// importPath of the package the descriptions of the page are written in
+	importPath string
+}
+
+// block renders the doc comment as markdown.
+func (r *docRenderer) block(text string) string {
+	if strings.TrimSpace(text) == "" {
+		return ""
+	}
+
+	doc := r.parse(text)
+	printer := &comment.Printer{
+		DocLinkURL:   r.url,
+		HeadingLevel: 3,
+		HeadingID:    func(*comment.Heading) string { return "" },
+	}
+	return strings.TrimSuffix(string(printer.Markdown(doc)), "\n")
+}
+
+// inline renders the doc comment in one line, so that it fits into a table cell.
+func (r *docRenderer) inline(text string) string {
+	if strings.TrimSpace(text) == "" {
+		return ""
+	}
+
+	lines := make([]string, 0)
+	for _, block := range r.parse(text).Content {
+		lines = append(lines, r.inlineBlock(block)...)
+	}
+	// pipes would end the table cell
+	return strings.ReplaceAll(strings.Join(lines, lineBreak), "|", "\\|")
+}
+
+func (r *docRenderer) inlineBlock(block comment.Block) []string {
+	switch b := block.(type) {
+	case *comment.Paragraph:
+		return []string{r.inlineText(b.Text)}
+	case *comment.Heading:
+		return []string{strings.Join([]string{"**", r.inlineText(b.Text), "**"}, "")}
+	case *comment.Code:
+		lines := make([]string, 0)
+		for _, line := range strings.Split(strings.TrimSuffix(b.Text, "\n"), "\n") {
+			lines = append(lines, strings.Join([]string{"`", line, "`"}, ""))
+		}
+		return lines
+	case *comment.List:
+		lines := make([]string, 0)
+		for _, item := range b.Items {
+			bullet := "-"
+			if item.Number != "" {
+				bullet = item.Number + "."
+			}
+			content := make([]string, 0)
+			for _, block := range item.Content {
+				content = append(content, r.inlineBlock(block)...)
+			}
+			lines = append(lines, strings.Join([]string{bullet, strings.Join(content, " ")}, " "))
+		}
+		return lines
+	}
+	return nil
+}
+
+func (r *docRenderer) inlineText(texts []comment.Text) string {
+	parts := make([]string, 0, len(texts))
+	for _, text := range texts {
+		switch t := text.(type) {
+		case comment.Plain:
+			parts = append(parts, strings.ReplaceAll(string(t), "\n", " "))
+		case comment.Italic:
+			parts = append(parts, strings.Join([]string{"*", strings.ReplaceAll(string(t), "\n", " "), "*"}, ""))
+		case *comment.Link:
+			parts = append(parts, r.inlineLink(r.inlineText(t.Text), t.URL))
+		case *comment.DocLink:
+			parts = append(parts, r.inlineLink(r.inlineText(t.Text), r.url(t)))
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+func (r *docRenderer) inlineLink(text, url string) string {
+	if url == "" {
+		return text
+	}
+	return strings.Join([]string{"[", text, "](", url, ")"}, "")
+}
+
+// parse parses the doc comment and names the doc links as they are read in
+// the package of the page, e.g. Foo for a type of the package and pkg.Foo
+// for the ones of other packages.
+func (r *docRenderer) parse(text string) *comment.Doc {
+	parser := &comment.Parser{}
+	doc := parser.Parse(text)
+	for _, block := range doc.Content {
+		r.relabel(block)
+	}
+	return doc
+}
+
+func (r *docRenderer) relabel(block comment.Block) {
+	switch b := block.(type) {
+	case *comment.Paragraph:
+		r.relabelText(b.Text)
+	case *comment.Heading:
+		r.relabelText(b.Text)
+	case *comment.List:
+		for _, item := range b.Items {
+			for _, content := range item.Content {
+				r.relabel(content)
+			}
+		}
+	}
+}
+
+func (r *docRenderer) relabelText(texts []comment.Text) {
+	for _, text := range texts {
+		link, ok := text.(*comment.DocLink)
+		if !ok {
+			continue
+		}
+
+		name := link.Name
+		if link.Recv != "" {
+			name = strings.Join([]string{link.Recv, link.Name}, ".")
+		}
+		switch {
+		case name == "":
+			name = link.ImportPath
+		case link.ImportPath != r.importPath:
+			name = strings.Join([]string{path.Base(link.ImportPath), name}, ".")
+		}
+		link.Text = []comment.Text{comment.Plain(name)}
+	}
+}
+
+// url returns the link to the page of the type the doc link names, or to
+// its documentation on pkg.go.dev if it has no page.
+func (r *docRenderer) url(link *comment.DocLink) string {
+	name := link.Name
+	if link.Recv != "" {
+		name = link.Recv
+	}
+	if file, found := r.pages[strings.Join([]string{link.ImportPath, name}, ".")]; found && r.dir != "" {
+		if rel, err := filepath.Rel(r.dir, file); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	if link.ImportPath == "" {
+		return ""
+	}
+	return link.DefaultURL(docBaseURL)
+}
@@ -4,50 +4,125 @@ import (
 	"github.com/caos/documentation/pkg/markdown"
 	"path/filepath"
 	"strings"
+	"unicode"
 )
 
 const (
 	fileEnding = "md"
 	titleAttr  = "Attribute"
+	titleType  = "Type"
 	titleDesc  = "Description"
 	titleDef   = "Default"
+	titleReq   = "Required"
+	titleRules = "Constraints"
 	titleCol   = "Collection"
 	titleMap   = "Map"
+	titleParam = "Type Parameter"
+	titleCons  = "Constraint"
+	titleValue = "Value"
 	linkPrefix = "[here]("
 	linkSuffix = ")"
+	seeBelow   = "see below"
+	recursive  = "recursive"
 )
 
+// AnonymousStruct is the type of attributes declared with an anonymous struct,
+// their pages are named after the attribute.
+const AnonymousStruct = "struct"
+
 type TreeElement struct {
 	AttributeName    string
 	FieldDescription string
 	TypeDescription  string
+	Representation   string
 	DefaultValue     string
+	DefaultBlock     bool
+	DefaultData      interface{}
 	GoType           string
 	GoName           string
 	GoPackage        string
+	GoPackagePath    string
+	GoImportPath     string
 	Collection       bool
 	Map              bool
 	Inline           bool
-	Replaced         bool
+	PromotedFrom     string
+	PromotionDepth   int
+	Tagged           bool
+	Required         bool
+	Recursive        bool
+	TypeParameters   []*TypeParameter
+	Enum             []*EnumValue
+	Constraints      []*Constraint
+	Example          string
+	Deprecated       bool
+	DeprecationNote  string
+	Since            string
+	See              []string
 	SubElements      []*TreeElement
 }
 
+// Constraint is a validation rule of an attribute, e.g. min=1 of a validate tag.
+type Constraint struct {
+	Name string
+	// parameter of the rule, e.g. 1 for min=1
+	Value string
+	// allowed values of oneof
+	Values []string
+	// the rule applies to the items of a collection or map
+	Items bool
+}
+
+type EnumValue struct {
+	Value       string
+	Description string
+}
+
+type TypeParameter struct {
+	Name       string
+	Constraint string
+}
+
 type TreeElementLine struct {
 	AttributeName    string
+	Type             string
 	FieldDescription string
 	DefaultValue     string
+	Required         string
+	Constraints      string
 	Collection       string
 	Map              string
 }
 
+// RenderOptions are the parts of a page which depend on where it is
+// generated. They are kept out of the elements, as these are shared between
+// documentations through the caches.
+type RenderOptions struct {
+	// Replace maps the go names of attributes to the pages of the types which can be used instead
+	Replace map[string]string
+	// Pages are the pages doc links link to
+	Pages Pages
+	// RecursionLinks are the links of recursive attributes to the pages of the types they reference
+	RecursionLinks map[*TreeElement]string
+}
+
 func (t *TreeElement) GetMDFile(basePath string, replace map[string]string) ([]byte, string) {
+	return t.Render(basePath, RenderOptions{Replace: replace})
+}
+
+// Render renders the page like GetMDFile with the options of where it is generated.
+func (t *TreeElement) Render(basePath string, opts RenderOptions) ([]byte, string) {
 	md := markdown.New()
+	r := &docRenderer{pages: opts.Pages, dir: filepath.Dir(t.GetMDFilePath(basePath)), importPath: t.GoImportPath}
 
-	md.AddHeader1(t.GoType)
+	md.AddHeader1(t.typeName())
 
 	anLength := len(titleAttr)
+	tyLength := len(titleType)
 	fdLength := len(titleDesc)
 	dvLength := len(titleDef)
+	rqLength := len(titleReq)
+	ruLength := len(titleRules)
 	coLength := len(titleCol)
 	mpLength := len(titleMap)
 	for _, subelement := range t.SubElements {
@@ -55,17 +130,23 @@ func (t *TreeElement) GetMDFile(basePath string, replace map[string]string) ([]b
 			continue
 		}
 
-		treeline := subelement.GetLine(replace)
+		treeline := subelement.getLine(opts, r)
 
 		if len(treeline.AttributeName) > anLength {
 			anLength = len(treeline.AttributeName)
 		}
+		if len(treeline.Type) > tyLength {
+			tyLength = len(treeline.Type)
+		}
 		if len(treeline.FieldDescription) > fdLength {
 			fdLength = len(treeline.FieldDescription)
 		}
 		if len(treeline.DefaultValue) > dvLength {
 			dvLength = len(treeline.DefaultValue)
 		}
+		if len(treeline.Constraints) > ruLength {
+			ruLength = len(treeline.Constraints)
+		}
 		if len(treeline.Collection) > coLength {
 			coLength = len(treeline.Collection)
 		}
@@ -74,18 +155,25 @@ func (t *TreeElement) GetMDFile(basePath string, replace map[string]string) ([]b
 		}
 	}
 
-	if t.TypeDescription != "" {
-		md.AddBlock(t.TypeDescription)
+	if desc := r.block(t.TypeDescription); desc != "" {
+		md.AddBlock(desc)
+	}
+
+	if len(t.TypeParameters) > 0 {
+		t.addTypeParameters(md)
 	}
 
 	md.AddHeader2("Structure")
 
 	headerEntries := []*markdown.TableEntry{
-		{titleAttr, anLength},
-		{titleDesc, fdLength},
-		{titleDef, dvLength},
-		{titleCol, coLength},
-		{titleMap, mpLength},
+		{Value: titleAttr, Width: anLength},
+		{Value: titleType, Width: tyLength},
+		{Value: titleDesc, Width: fdLength},
+		{Value: titleDef, Width: dvLength},
+		{Value: titleReq, Width: rqLength},
+		{Value: titleRules, Width: ruLength},
+		{Value: titleCol, Width: coLength},
+		{Value: titleMap, Width: mpLength},
 	}
 	md.AddTableHeader(headerEntries)
 
@@ -93,26 +181,197 @@ func (t *TreeElement) GetMDFile(basePath string, replace map[string]string) ([]b
 		if subelement == nil {
 			continue
 		}
-		treeline := subelement.GetLine(replace)
+		treeline := subelement.getLine(opts, r)
 
 		entries := []*markdown.TableEntry{
-			{treeline.AttributeName, anLength},
-			{treeline.FieldDescription, fdLength},
-			{treeline.DefaultValue, dvLength},
-			{treeline.Collection, coLength},
-			{treeline.Map, mpLength},
+			{Value: treeline.AttributeName, Width: anLength},
+			{Value: treeline.Type, Width: tyLength},
+			{Value: treeline.FieldDescription, Width: fdLength},
+			{Value: treeline.DefaultValue, Width: dvLength},
+			{Value: treeline.Required, Width: rqLength},
+			{Value: treeline.Constraints, Width: ruLength},
+			{Value: treeline.Collection, Width: coLength},
+			{Value: treeline.Map, Width: mpLength},
 		}
 		md.AddTableLine(entries)
 	}
 
-	return md.Build(), filepath.Join(basePath, strings.Join([]string{t.GoType, fileEnding}, "."))
+	t.addAllowedValues(md, r)
+	t.addDefaults(md)
+	t.addExamples(md)
+	t.addDeprecations(md)
+
+	return md.Build(), t.GetMDFilePath(basePath)
+}
+
+func (t *TreeElement) GetMDFilePath(basePath string) string {
+	return filepath.Join(basePath, strings.Join([]string{t.GetPageName(), fileEnding}, "."))
+}
+
+// typeConstructors spells out the type constructors of type arguments for page names.
+var typeConstructors = strings.NewReplacer("[]", "_Slice_", "*", "_Ptr_", "map[", "_Map_", "chan ", "_Chan_")
+
+// GetPageName returns the name of the page and the directory of the page of
+// the type. Instances of generic types are named after their type arguments,
+// e.g. Pair_string_int for Pair[string, int], as brackets and spaces would
+// break links. Type constructors are spelled out, so that e.g. Box[*Foo] and
+// Box[[]*Foo] get pages of their own.
+func (t *TreeElement) GetPageName() string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, typeConstructors.Replace(t.typeName()))
+	for strings.Contains(name, "__") {
+		name = strings.ReplaceAll(name, "__", "_")
+	}
+	return strings.Trim(name, "_")
+}
+
+// typeName returns the type of the element, anonymous structs are named after their attribute.
+func (t *TreeElement) typeName() string {
+	if t.GoType == AnonymousStruct && t.GoName != "" {
+		return t.GoName
+	}
+	return t.GoType
+}
+
+func (t *TreeElement) addTypeParameters(md *markdown.Markdown) {
+	md.AddHeader2("Type Parameters")
+
+	npLength := len(titleParam)
+	csLength := len(titleCons)
+	for _, param := range t.TypeParameters {
+		if len(param.Name) > npLength {
+			npLength = len(param.Name)
+		}
+		if len(param.Constraint) > csLength {
+			csLength = len(param.Constraint)
+		}
+	}
+
+	md.AddTableHeader([]*markdown.TableEntry{
+		{Value: titleParam, Width: npLength},
+		{Value: titleCons, Width: csLength},
+	})
+	for _, param := range t.TypeParameters {
+		md.AddTableLine([]*markdown.TableEntry{
+			{Value: param.Name, Width: npLength},
+			{Value: param.Constraint, Width: csLength},
+		})
+	}
+	md.AddLine("")
+}
+
+func (t *TreeElement) addAllowedValues(md *markdown.Markdown, r *docRenderer) {
+	header := false
+	for _, subelement := range t.SubElements {
+		if subelement == nil || len(subelement.Enum) == 0 {
+			continue
+		}
+		if !header {
+			md.AddLine("")
+			md.AddHeader2("Allowed values")
+			header = true
+		}
+
+		md.AddHeader3(subelement.AttributeName)
+
+		vaLength := len(titleValue)
+		fdLength := len(titleDesc)
+		descriptions := make([]string, 0, len(subelement.Enum))
+		for _, value := range subelement.Enum {
+			desc := r.inline(value.Description)
+			descriptions = append(descriptions, desc)
+			if len(value.Value) > vaLength {
+				vaLength = len(value.Value)
+			}
+			if len(desc) > fdLength {
+				fdLength = len(desc)
+			}
+		}
+
+		md.AddTableHeader([]*markdown.TableEntry{
+			{Value: titleValue, Width: vaLength},
+			{Value: titleDesc, Width: fdLength},
+		})
+		for i, value := range subelement.Enum {
+			md.AddTableLine([]*markdown.TableEntry{
+				{Value: value.Value, Width: vaLength},
+				{Value: descriptions[i], Width: fdLength},
+			})
+		}
+		md.AddLine("")
+	}
+}
+
+func (t *TreeElement) addDefaults(md *markdown.Markdown) {
+	header := false
+	for _, subelement := range t.SubElements {
+		if subelement == nil || !subelement.DefaultBlock {
+			continue
+		}
+		if !header {
+			md.AddLine("")
+			md.AddHeader2("Default values")
+			header = true
+		}
+
+		md.AddHeader3(subelement.AttributeName)
+		md.AddCodeBlock("yaml", subelement.DefaultValue)
+	}
+}
+
+func (t *TreeElement) addExamples(md *markdown.Markdown) {
+	header := false
+	for _, subelement := range t.SubElements {
+		if subelement == nil || subelement.Example == "" {
+			continue
+		}
+		if !header {
+			md.AddLine("")
+			md.AddHeader2("Examples")
+			header = true
+		}
+
+		md.AddHeader3(subelement.AttributeName)
+		md.AddCodeBlock("yaml", subelement.Example)
+	}
+}
+
+func (t *TreeElement) addDeprecations(md *markdown.Markdown) {
+	header := false
+	for _, subelement := range t.SubElements {
+		if subelement == nil || !subelement.Deprecated || subelement.DeprecationNote == "" {
+			continue
+		}
+		if !header {
+			md.AddLine("")
+			md.AddHeader2("Deprecated")
+			header = true
+		}
+
+		md.AddHeader3(subelement.AttributeName)
+		md.AddBlock(subelement.DeprecationNote)
+	}
+}
+
+// IsReplaced checks if the attribute is documented by the page of another
+// type, which replace maps its go name to.
+func (t *TreeElement) IsReplaced(replace map[string]string) bool {
+	_, found := replace[t.GoName]
+	return found
 }
 
 func (t *TreeElement) GetLine(replace map[string]string) *TreeElementLine {
-	if replace != nil {
-		replaceValue, found := replace[t.GoName]
+	return t.getLine(RenderOptions{Replace: replace}, &docRenderer{importPath: t.GoImportPath})
+}
+
+func (t *TreeElement) getLine(opts RenderOptions, r *docRenderer) *TreeElementLine {
+	if opts.Replace != nil {
+		replaceValue, found := opts.Replace[t.GoName]
 		if found {
-			t.Replaced = true
 			fieldDesc := strings.Join([]string{"Any Kind from Type ", linkPrefix, "../../../" + replaceValue, linkSuffix, " can be used"}, "")
 
 			col := ""
@@ -126,17 +385,30 @@ func (t *TreeElement) GetLine(replace map[string]string) *TreeElementLine {
 			}
 			return &TreeElementLine{
 				AttributeName:    t.AttributeName,
+				Type:             t.getType(),
 				FieldDescription: fieldDesc,
-				DefaultValue:     t.DefaultValue,
+				DefaultValue:     t.getDefault(),
+				Required:         t.getRequired(),
+				Constraints:      t.getConstraints(),
 				Collection:       col,
 				Map:              mp,
 			}
 		}
 	}
 
-	fieldDesc := t.FieldDescription
-	if t.SubElements != nil && len(t.SubElements) > 0 {
-		linkPath := filepath.Join(t.GoPackage, t.GoType, strings.Join([]string{t.GoType, fileEnding}, "."))
+	fieldDesc := t.getDescription(r)
+	if t.Recursive {
+		recursiveDesc := recursive
+		if link := opts.RecursionLinks[t]; link != "" {
+			recursiveDesc = strings.Join([]string{recursive, ", ", linkPrefix, link, linkSuffix}, "")
+		}
+		if fieldDesc != "" {
+			fieldDesc = strings.Join([]string{fieldDesc, ", ", recursiveDesc}, "")
+		} else {
+			fieldDesc = recursiveDesc
+		}
+	} else if t.SubElements != nil && len(t.SubElements) > 0 {
+		linkPath := filepath.Join(t.GoPackage, t.GetPageName(), strings.Join([]string{t.GetPageName(), fileEnding}, "."))
 
 		if fieldDesc != "" {
 			fieldDesc = strings.Join([]string{fieldDesc, ", ", linkPrefix, linkPath, linkSuffix}, "")
@@ -157,9 +429,116 @@ func (t *TreeElement) GetLine(replace map[string]string) *TreeElementLine {
 
 	return &TreeElementLine{
 		AttributeName:    t.AttributeName,
+		Type:             t.getType(),
 		FieldDescription: fieldDesc,
-		DefaultValue:     t.DefaultValue,
+		DefaultValue:     t.getDefault(),
+		Required:         t.getRequired(),
+		Constraints:      t.getConstraints(),
 		Collection:       col,
 		Map:              mp,
 	}
 }
+
+// getType returns the representation of the element if it has one, e.g. for
+// durations or free-form values, or its go type.
+func (t *TreeElement) getType() string {
+	if t.Representation != "" {
+		return t.Representation
+	}
+	return t.GoType
+}
+
+func (t *TreeElement) getDefault() string {
+	if t.DefaultBlock {
+		return seeBelow
+	}
+	return t.DefaultValue
+}
+
+func (t *TreeElement) getRequired() string {
+	if t.Required {
+		return "X"
+	}
+	return ""
+}
+
+// getDescription returns the field description with badges for deprecated
+// fields and the version they were added in, the embedded type promoted
+// fields come from and the links to see.
+func (t *TreeElement) getDescription(r *docRenderer) string {
+	parts := make([]string, 0)
+	if t.Deprecated {
+		parts = append(parts, "`deprecated`")
+	}
+	if t.Since != "" {
+		parts = append(parts, "`since "+t.Since+"`")
+	}
+	if desc := r.inline(t.FieldDescription); desc != "" {
+		parts = append(parts, desc)
+	}
+	desc := strings.Join(parts, " ")
+
+	if t.PromotedFrom != "" {
+		promoted := strings.Join([]string{"promoted from `", t.PromotedFrom, "`"}, "")
+		if desc != "" {
+			desc = strings.Join([]string{desc, promoted}, ", ")
+		} else {
+			desc = promoted
+		}
+	}
+
+	if len(t.See) > 0 {
+		links := make([]string, 0, len(t.See))
+		for _, see := range t.See {
+			if strings.Contains(see, "://") {
+				see = strings.Join([]string{"[", see, "](", see, ")"}, "")
+			}
+			links = append(links, see)
+		}
+		see := strings.Join([]string{"see", strings.Join(links, ", ")}, " ")
+		if desc != "" {
+			desc = strings.Join([]string{desc, see}, ", ")
+		} else {
+			desc = see
+		}
+	}
+	return desc
+}
+
+func (t *TreeElement) getConstraints() string {
+	rules := make([]string, 0, len(t.Constraints))
+	for _, constraint := range t.Constraints {
+		rules = append(rules, constraint.String())
+	}
+	// pipes in parameters would end the table cell
+	return strings.ReplaceAll(strings.Join(rules, ", "), "|", "\\|")
+}
+
+// constraintLabels are the readable names of comparing rules
+var constraintLabels = map[string]string{
+	"len": "length",
+	"eq":  "=",
+	"ne":  "!=",
+	"gt":  ">",
+	"gte": ">=",
+	"lt":  "<",
+	"lte": "<=",
+}
+
+func (c *Constraint) String() string {
+	rule := strings.ReplaceAll(c.Name, "|", " or ")
+	switch {
+	case c.Name == "oneof":
+		rule = strings.Join([]string{"one of (", strings.Join(c.Values, ", "), ")"}, "")
+	case c.Value != "":
+		if label, found := constraintLabels[c.Name]; found {
+			rule = label
+		}
+		rule = strings.Join([]string{rule, c.Value}, " ")
+	}
+
+	if c.Items {
+		return strings.Join([]string{"items", rule}, " ")
+	}
+	return rule
+}